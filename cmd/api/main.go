@@ -15,6 +15,10 @@ import (
 	"pricesapi/internal/config"
 	"pricesapi/internal/db"
 	"pricesapi/internal/httpapi"
+	"pricesapi/internal/idempotency"
+	"pricesapi/internal/jobs"
+	"pricesapi/internal/prices"
+	"pricesapi/internal/uploads"
 )
 
 func main() {
@@ -32,14 +36,37 @@ func main() {
 	}
 	defer pool.Close()
 
-	if err := db.Migrate(pool); err != nil {
+	priceColumn := prices.NewPriceColumn(cfg.PriceScale)
+	if err := db.Migrate(pool, priceColumn.Precision, priceColumn.Scale); err != nil {
 		logger.Error("db migrate failed", "err", err)
 		os.Exit(1)
 	}
 
+	svc := prices.NewService(pool, logger, prices.ArchiveLimits{
+		MaxDecompressedBytes: cfg.ArchiveMaxDecompressedMB * 1024 * 1024,
+		MaxRatio:             cfg.ArchiveMaxRatio,
+		MaxEntries:           cfg.ArchiveMaxEntries,
+		MaxDepth:             cfg.ArchiveMaxDepth,
+	}, priceColumn)
+
+	// фоновые импорты живут до остановки сервера
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	runner := jobs.NewRunner(pool, svc, logger, cfg.ImportWorkers)
+	if err := runner.Start(jobsCtx); err != nil {
+		logger.Error("import jobs start failed", "err", err)
+		os.Exit(1)
+	}
+
+	store, err := uploads.NewStore(cfg.UploadDir, cfg.UploadSessionTTL, cfg.MaxUploadMB*1024*1024, logger)
+	if err != nil {
+		logger.Error("upload store init failed", "err", err)
+		os.Exit(1)
+	}
+	go store.RunJanitor(jobsCtx, time.Minute, runner.UploadInUse)
+
 	srv := &http.Server{
 		Addr:         cfg.HTTPAddr,
-		Handler:      httpapi.NewRouter(pool, logger, cfg),
+		Handler:      httpapi.NewRouter(svc, runner, store, idempotency.NewStore(pool), logger, cfg),
 		ReadTimeout:  60 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -62,5 +89,7 @@ func main() {
 
 	logger.Info("shutting down")
 	_ = srv.Shutdown(ctx)
+	stopJobs()
+	runner.Wait()
 	logger.Info("bye")
 }
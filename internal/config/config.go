@@ -4,8 +4,10 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -13,6 +15,18 @@ type Config struct {
 	LogLevel    slog.Level
 	MaxUploadMB int64
 	DBHost string
+	ImportWorkers int
+	UploadDir string
+	UploadSessionTTL time.Duration
+	// хосты, с которых разрешён импорт по URL; "*.example.com" — поддомены
+	ImportURLAllowedHosts []string
+	// ограничения распаковки архивов, 0 — без ограничения
+	ArchiveMaxDecompressedMB int64
+	ArchiveMaxRatio float64
+	ArchiveMaxEntries int
+	ArchiveMaxDepth int
+	// знаков после точки в prices.price; до точки всегда 10
+	PriceScale int
 }
 
 func MustLoad() Config {
@@ -41,12 +55,66 @@ func MustLoad() Config {
 
 	dbHost := getEnv("DB_HOST", "localhost")
 
+	workersStr := getEnv("IMPORT_WORKERS", "2")
+	workers, err := strconv.Atoi(workersStr)
+	if err != nil || workers <= 0 {
+		log.Fatalf("invalid IMPORT_WORKERS=%s", workersStr)
+	}
+
+	uploadDir := getEnv("UPLOAD_DIR", filepath.Join(os.TempDir(), "pricesapi-uploads"))
+
+	ttlStr := getEnv("UPLOAD_SESSION_TTL", "24h")
+	ttl, err := time.ParseDuration(ttlStr)
+	if err != nil || ttl <= 0 {
+		log.Fatalf("invalid UPLOAD_SESSION_TTL=%s", ttlStr)
+	}
+
+	var allowedHosts []string
+	for _, h := range strings.Split(getEnv("IMPORT_URL_ALLOWED_HOSTS", ""), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			allowedHosts = append(allowedHosts, h)
+		}
+	}
+
+	archiveMaxMB := mustNonNegative("ARCHIVE_MAX_DECOMPRESSED_MB", "2048")
+	archiveMaxEntries := mustNonNegative("ARCHIVE_MAX_ENTRIES", "1000")
+	archiveMaxDepth := mustNonNegative("ARCHIVE_MAX_DEPTH", "8")
+
+	ratioStr := getEnv("ARCHIVE_MAX_RATIO", "200")
+	ratio, err := strconv.ParseFloat(ratioStr, 64)
+	if err != nil || ratio < 0 {
+		log.Fatalf("invalid ARCHIVE_MAX_RATIO=%s", ratioStr)
+	}
+
+	priceScale := mustNonNegative("PRICE_SCALE", "2")
+	if priceScale > 6 {
+		log.Fatalf("invalid PRICE_SCALE=%d (max 6)", priceScale)
+	}
+
 	return Config{
 		HTTPAddr:    httpAddr,
 		LogLevel:    lvl,
 		MaxUploadMB: maxMB,
 		DBHost:      dbHost,
+		ImportWorkers: workers,
+		UploadDir: uploadDir,
+		UploadSessionTTL: ttl,
+		ImportURLAllowedHosts: allowedHosts,
+		ArchiveMaxDecompressedMB: archiveMaxMB,
+		ArchiveMaxRatio: ratio,
+		ArchiveMaxEntries: int(archiveMaxEntries),
+		ArchiveMaxDepth: int(archiveMaxDepth),
+		PriceScale: int(priceScale),
+	}
+}
+
+func mustNonNegative(key, def string) int64 {
+	s := getEnv(key, def)
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		log.Fatalf("invalid %s=%s", key, s)
 	}
+	return n
 }
 
 func getEnv(key, def string) string {
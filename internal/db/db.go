@@ -2,9 +2,11 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -14,6 +16,7 @@ const (
 	DBName = "project-sem-1"
 	DBPort = 5432
 	TablePrices = "prices"
+	TableImports = "imports"
 )
 
 func Open(host string) (*pgxpool.Pool, error) {
@@ -43,51 +46,171 @@ func Open(host string) (*pgxpool.Pool, error) {
 	return pool, nil
 }
 
-func Migrate(pool *pgxpool.Pool) error {
+// Migrate создаёт схему. Колонка цены — NUMERIC(pricePrecision, priceScale),
+// масштаб задаётся PRICE_SCALE.
+func Migrate(pool *pgxpool.Pool, pricePrecision, priceScale int32) error {
 	ctx := context.Background()
+	priceType := fmt.Sprintf("NUMERIC(%d,%d)", pricePrecision, priceScale)
 
 	if _, err := pool.Exec(ctx, `
 CREATE TABLE IF NOT EXISTS prices (
   id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
   name TEXT NOT NULL,
   category TEXT NOT NULL,
-  price NUMERIC(12,2) NOT NULL CHECK (price > 0),
+  price `+priceType+` NOT NULL CHECK (price > 0),
   create_date DATE NOT NULL
 );`); err != nil {
 		return err
 	}
 
+	// уменьшение масштаба округлило бы уже загруженные цены
+	var curScale int32
+	err := pool.QueryRow(ctx, `
+SELECT COALESCE(numeric_scale, 0) FROM information_schema.columns
+WHERE table_schema = current_schema() AND table_name = 'prices' AND column_name = 'price';`).Scan(&curScale)
+	if err == nil && curScale > priceScale {
+		return fmt.Errorf("prices.price has scale %d, PRICE_SCALE=%d would round stored prices", curScale, priceScale)
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
 	stmts := []string{
 		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS id BIGINT GENERATED BY DEFAULT AS IDENTITY;`,
 		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS name TEXT;`,
 		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS category TEXT;`,
-		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS price NUMERIC(12,2);`,
+		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS price `+priceType+`;`,
 		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS create_date DATE;`,
-		`ALTER TABLE prices ALTER COLUMN price TYPE NUMERIC(12,2) USING price::numeric;`,
+		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'RUB';`,
 	}
 
 	for _, q := range stmts {
 		_, _ = pool.Exec(ctx, q)
 	}
 
+	// масштаб колонки обязан совпасть с PRICE_SCALE: сервис округляет цены под него
+	if _, err := pool.Exec(ctx, `ALTER TABLE prices ALTER COLUMN price TYPE `+priceType+` USING price::numeric;`); err != nil {
+		return fmt.Errorf("set price column to %s: %w", priceType, err)
+	}
+
 	if _, err := pool.Exec(ctx, `
 DO $$
 BEGIN
+  -- старый вариант ограничения был без currency
+  IF EXISTS (
+    SELECT 1 FROM pg_constraint
+    WHERE conname = 'ux_prices_dedupe' AND conrelid = 'prices'::regclass
+      AND array_length(conkey, 1) = 4
+  ) THEN
+    ALTER TABLE prices DROP CONSTRAINT ux_prices_dedupe;
+  END IF;
   IF NOT EXISTS (
     SELECT 1 FROM pg_constraint
     WHERE conname = 'ux_prices_dedupe' AND conrelid = 'prices'::regclass
   ) THEN
     ALTER TABLE prices
-      ADD CONSTRAINT ux_prices_dedupe UNIQUE (name, category, price, create_date);
+      ADD CONSTRAINT ux_prices_dedupe UNIQUE (name, category, price, create_date, currency);
   END IF;
 END$$;`); err != nil {
 		return err
 	}
 
+	// задачи импорта (асинхронные загрузки)
+	if _, err := pool.Exec(ctx, `
+CREATE TABLE IF NOT EXISTS imports (
+  id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  state TEXT NOT NULL,
+  options JSONB NOT NULL DEFAULT '{}',
+  upload_path TEXT NOT NULL DEFAULT '',
+  rows_processed BIGINT NOT NULL DEFAULT 0,
+  result JSONB,
+  error TEXT,
+  error_code TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  started_at TIMESTAMPTZ,
+  finished_at TIMESTAMPTZ
+);`); err != nil {
+		return err
+	}
+	// сколько раз задачу брали в работу, чтобы не перезапускать её вечно
+	if _, err := pool.Exec(ctx, `ALTER TABLE imports ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;`); err != nil {
+		return err
+	}
+
+	// происхождение: откуда импорт и какие строки prices он вставил
+	provenance := []string{
+		`ALTER TABLE imports ADD COLUMN IF NOT EXISTS async BOOLEAN NOT NULL DEFAULT true;`,
+		`ALTER TABLE imports ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE imports ADD COLUMN IF NOT EXISTS filename TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE imports ADD COLUMN IF NOT EXISTS checksum TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE imports ADD COLUMN IF NOT EXISTS uploader TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE imports ADD COLUMN IF NOT EXISTS entries TEXT[] NOT NULL DEFAULT '{}';`,
+		`ALTER TABLE imports ADD COLUMN IF NOT EXISTS total_count BIGINT;`,
+		`ALTER TABLE imports ADD COLUMN IF NOT EXISTS inserted_count BIGINT;`,
+		`ALTER TABLE imports ADD COLUMN IF NOT EXISTS updated_count BIGINT;`,
+		`ALTER TABLE imports ADD COLUMN IF NOT EXISTS duplicates_count BIGINT;`,
+		`ALTER TABLE imports ADD COLUMN IF NOT EXISTS rejected_count BIGINT;`,
+		`ALTER TABLE imports ADD COLUMN IF NOT EXISTS undone_at TIMESTAMPTZ;`,
+		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS import_id BIGINT REFERENCES imports(id);`,
+		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS source_entry TEXT;`,
+		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS source_line BIGINT;`,
+		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS updated_import_id BIGINT REFERENCES imports(id);`,
+		// id поставщика; уникален только внутри source
+		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE prices ADD COLUMN IF NOT EXISTS external_id TEXT;`,
+	}
+	for _, q := range provenance {
+		if _, err := pool.Exec(ctx, q); err != nil {
+			return err
+		}
+	}
+
+	// курсы валют к базовой (RUB): rate — сколько RUB за 1 единицу currency,
+	// действует с valid_from до следующей записи
+	if _, err := pool.Exec(ctx, `
+CREATE TABLE IF NOT EXISTS currency_rates (
+  currency TEXT NOT NULL,
+  valid_from DATE NOT NULL,
+  rate NUMERIC(20,10) NOT NULL CHECK (rate > 0),
+  PRIMARY KEY (currency, valid_from)
+);`); err != nil {
+		return err
+	}
+
+	// профили сопоставления колонок (ColumnMapping в json)
+	if _, err := pool.Exec(ctx, `
+CREATE TABLE IF NOT EXISTS column_mappings (
+  name TEXT PRIMARY KEY,
+  mapping JSONB NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);`); err != nil {
+		return err
+	}
+
+	// ответы на запросы с Idempotency-Key; status IS NULL — запрос ещё выполняется
+	if _, err := pool.Exec(ctx, `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  key TEXT PRIMARY KEY,
+  fingerprint TEXT NOT NULL,
+  status INT,
+  content_type TEXT NOT NULL DEFAULT '',
+  headers JSONB NOT NULL DEFAULT '{}',
+  body BYTEA,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ
+);`); err != nil {
+		return err
+	}
+
 	idx := []string{
 		`CREATE INDEX IF NOT EXISTS ix_prices_date ON prices(create_date);`,
 		`CREATE INDEX IF NOT EXISTS ix_prices_price ON prices(price);`,
 		`CREATE INDEX IF NOT EXISTS ix_prices_category ON prices(category);`,
+		`CREATE INDEX IF NOT EXISTS ix_imports_state ON imports(state, id);`,
+		`CREATE INDEX IF NOT EXISTS ix_prices_import ON prices(import_id);`,
+		`CREATE INDEX IF NOT EXISTS ix_prices_updated_import ON prices(updated_import_id);`,
+		`CREATE INDEX IF NOT EXISTS ix_prices_external_id ON prices(source, external_id) WHERE external_id IS NOT NULL;`,
+		`CREATE INDEX IF NOT EXISTS ix_idempotency_keys_created ON idempotency_keys(created_at);`,
 	}
 	for _, q := range idx {
 		if _, err := pool.Exec(ctx, q); err != nil {
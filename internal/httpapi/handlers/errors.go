@@ -2,11 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"pricesapi/internal/prices"
 )
 
 type apiError struct {
 	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
 }
 
 func writeJSON(w http.ResponseWriter, status int, v any) {
@@ -22,3 +26,43 @@ func badRequest(w http.ResponseWriter, msg string) {
 func serverError(w http.ResponseWriter, msg string) {
 	writeJSON(w, http.StatusInternalServerError, apiError{Error: msg})
 }
+
+// importFailed отдаёт ошибки из-за входных данных как 4xx с кодом,
+// всё остальное — как 500.
+func importFailed(w http.ResponseWriter, err error) {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, apiError{Error: err.Error()})
+		return
+	}
+
+	var ie *prices.ImportError
+	if errors.As(err, &ie) {
+		writeJSON(w, importErrorStatus(ie.Code), apiError{Error: ie.Msg, Code: ie.Code})
+		return
+	}
+	serverError(w, err.Error())
+}
+
+func importErrorStatus(code string) int {
+	switch code {
+	case prices.CodeUnsupportedFormat:
+		return http.StatusUnsupportedMediaType
+	case prices.CodeTypeMismatch, prices.CodeAmbiguousDate, prices.CodeNoRate, prices.CodeUnknownMapping:
+		return http.StatusUnprocessableEntity
+	case prices.CodeDuplicates:
+		return http.StatusConflict
+	case prices.CodeURLNotAllowed:
+		return http.StatusForbidden
+	case prices.CodeDownloadFailed:
+		return http.StatusBadGateway
+	case prices.CodeDownloadTooLarge, prices.CodeDecompressedTooLarge, prices.CodeCompressionRatio, prices.CodeTooManyEntries:
+		return http.StatusRequestEntityTooLarge
+	case prices.CodeNestingTooDeep, prices.CodeUnsafeEntryPath:
+		return http.StatusUnprocessableEntity
+	case prices.CodeChecksumMismatch:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadRequest
+	}
+}
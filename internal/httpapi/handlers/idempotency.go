@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"pricesapi/internal/idempotency"
+)
+
+// Заголовки ответа, которые надо воспроизвести при повторе.
+var replayHeaders = []string{"Content-Disposition", "Location"}
+
+// withIdempotency выполняет run не более одного раза на ключ. Отпечаток
+// запроса — sha256 загруженного файла плюс параметры запроса, так что
+// повтор того же файла с другими параметрами тоже считается конфликтом.
+func withIdempotency(w http.ResponseWriter, r *http.Request, idem *idempotency.Store, key, tempPath string, cleanup func(), run func(http.ResponseWriter)) {
+	fp, err := requestFingerprint(tempPath, r.URL.Query())
+	if err != nil {
+		cleanup()
+		serverError(w, err.Error())
+		return
+	}
+
+	replay, err := idem.Begin(r.Context(), key, fp)
+	if err != nil {
+		cleanup()
+		switch {
+		case errors.Is(err, idempotency.ErrKeyReused):
+			writeJSON(w, http.StatusConflict, apiError{Error: err.Error(), Code: "idempotency_key_reused"})
+		case errors.Is(err, idempotency.ErrInProgress):
+			writeJSON(w, http.StatusConflict, apiError{Error: err.Error(), Code: "idempotency_key_in_progress"})
+		default:
+			serverError(w, err.Error())
+		}
+		return
+	}
+	if replay != nil {
+		cleanup()
+		for k, v := range replay.Headers {
+			w.Header().Set(k, v)
+		}
+		w.Header().Set("Content-Type", replay.ContentType)
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(replay.Status)
+		_, _ = w.Write(replay.Body)
+		return
+	}
+
+	rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	run(rec)
+
+	// ответ уже ушёл клиенту, ключ сохраняем даже если запрос отменили
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if rec.status >= 500 {
+		_ = idem.Abort(ctx, key)
+		return
+	}
+	resp := idempotency.Response{
+		Status:      rec.status,
+		ContentType: rec.Header().Get("Content-Type"),
+		Headers:     map[string]string{},
+		Body:        rec.body.Bytes(),
+	}
+	for _, h := range replayHeaders {
+		if v := rec.Header().Get(h); v != "" {
+			resp.Headers[h] = v
+		}
+	}
+	if err := idem.Complete(ctx, key, resp); err != nil {
+		_ = idem.Abort(ctx, key)
+	}
+}
+
+func requestFingerprint(path string, q url.Values) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	// Encode сортирует ключи, порядок параметров не важен
+	h.Write([]byte{0})
+	h.Write([]byte(q.Encode()))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// responseRecorder пишет ответ клиенту и параллельно копит его для повтора.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
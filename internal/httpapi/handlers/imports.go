@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"pricesapi/internal/jobs"
+)
+
+const (
+	defaultImportsLimit = 50
+	maxImportsLimit     = 500
+)
+
+// ListImports: ?limit=, ?before_id= (страница старше этого id), ?state=.
+func ListImports(runner *jobs.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		f := jobs.ListFilter{Limit: defaultImportsLimit}
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > maxImportsLimit {
+				badRequest(w, fmt.Sprintf("query param 'limit' must be between 1 and %d", maxImportsLimit))
+				return
+			}
+			f.Limit = n
+		}
+		if v := q.Get("before_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id <= 0 {
+				badRequest(w, "query param 'before_id' must be a positive integer")
+				return
+			}
+			f.BeforeID = id
+		}
+		switch f.State = q.Get("state"); f.State {
+		case "", jobs.StateQueued, jobs.StateRunning, jobs.StateSucceeded, jobs.StateFailed:
+		default:
+			badRequest(w, "query param 'state' must be one of: queued, running, succeeded, failed")
+			return
+		}
+
+		list, err := runner.List(r.Context(), f)
+		if err != nil {
+			serverError(w, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
+
+func GetImport(runner *jobs.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := importID(w, r)
+		if !ok {
+			return
+		}
+
+		job, err := runner.Get(r.Context(), id)
+		if errors.Is(err, jobs.ErrNotFound) {
+			writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+			return
+		}
+		if err != nil {
+			serverError(w, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+// undoConflict — 409 с тем, что удалил бы откат, чтобы клиент решил про ?force=true.
+type undoConflict struct {
+	apiError
+	Undo jobs.UndoResult `json:"undo"`
+}
+
+// DeleteImport откатывает импорт: удаляет вставленные им строки.
+// ?force=true — удалить, даже если их потом обновляли другие импорты.
+func DeleteImport(runner *jobs.Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := importID(w, r)
+		if !ok {
+			return
+		}
+		force, err := parseBoolParam(r.URL.Query(), "force")
+		if err != nil {
+			badRequest(w, err.Error())
+			return
+		}
+
+		res, err := runner.Undo(r.Context(), id, force)
+		switch {
+		case err == nil:
+			writeJSON(w, http.StatusOK, res)
+		case errors.Is(err, jobs.ErrNotFound):
+			writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+		case errors.Is(err, jobs.ErrDependentImports):
+			writeJSON(w, http.StatusConflict, undoConflict{
+				apiError: apiError{Error: err.Error() + "; repeat with force=true to remove them anyway", Code: "dependent_imports"},
+				Undo:     res,
+			})
+		case errors.Is(err, jobs.ErrNotUndoable), errors.Is(err, jobs.ErrAlreadyUndone):
+			writeJSON(w, http.StatusConflict, apiError{Error: err.Error()})
+		default:
+			serverError(w, err.Error())
+		}
+	}
+}
+
+func importID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		badRequest(w, "invalid import id")
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"pricesapi/internal/prices"
+)
+
+func ListMappings(svc *prices.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := svc.ListMappings(r.Context())
+		if err != nil {
+			serverError(w, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
+
+func GetMapping(svc *prices.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m, err := svc.GetMapping(r.Context(), r.PathValue("name"))
+		if err != nil {
+			mappingFailed(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, m)
+	}
+}
+
+// PutMapping: тело — ColumnMapping без name, имя берётся из пути.
+func PutMapping(svc *prices.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var m prices.ColumnMapping
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&m); err != nil {
+			badRequest(w, "invalid json body: "+err.Error())
+			return
+		}
+		name := r.PathValue("name")
+		if m.Name != "" && m.Name != name {
+			badRequest(w, "field 'name' does not match the path")
+			return
+		}
+		m.Name = name
+
+		created, err := svc.PutMapping(r.Context(), m)
+		if err != nil {
+			mappingFailed(w, err)
+			return
+		}
+
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, m)
+	}
+}
+
+func DeleteMapping(svc *prices.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := svc.DeleteMapping(r.Context(), r.PathValue("name")); err != nil {
+			mappingFailed(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func mappingFailed(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, prices.ErrMappingNotFound):
+		writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+	case errors.Is(err, prices.ErrBuiltinMapping):
+		writeJSON(w, http.StatusConflict, apiError{Error: err.Error()})
+	case errors.Is(err, prices.ErrInvalidMapping):
+		badRequest(w, err.Error())
+	default:
+		serverError(w, err.Error())
+	}
+}
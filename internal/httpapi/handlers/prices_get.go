@@ -16,7 +16,8 @@ func GetPrices(svc *prices.Service) http.HandlerFunc {
 
 		zipBytes, err := svc.ExportZip(r.Context(), f)
 		if err != nil {
-			serverError(w, err.Error())
+			// нет курса для пересчёта — ошибка запроса, а не сервера
+			importFailed(w, err)
 			return
 		}
 
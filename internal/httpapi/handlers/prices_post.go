@@ -1,21 +1,70 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
 	"strings"
 
 	"pricesapi/internal/config"
+	"pricesapi/internal/idempotency"
+	"pricesapi/internal/jobs"
 	"pricesapi/internal/prices"
 )
 
-func PostPrices(svc *prices.Service, cfg config.Config) http.HandlerFunc {
+func PostPrices(svc *prices.Service, runner *jobs.Runner, idem *idempotency.Store, cfg config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		archType := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("type")))
-		if archType == "" {
-			archType = "zip"
+		ir, err := parseImportRequest(r.URL.Query())
+		if err != nil {
+			badRequest(w, err.Error())
+			return
 		}
-		if archType != "zip" && archType != "tar" {
-			badRequest(w, "query param 'type' must be 'zip' or 'tar'")
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		isJSON := mediaType == "application/json" || mediaType == "application/x-ndjson" || mediaType == "application/ndjson"
+		ndjson := isJSON && mediaType != "application/json"
+		if isJSON {
+			if ir.opts.Type != "" || len(ir.opts.Entries) > 0 || ir.opts.Mapping != "" {
+				badRequest(w, "query params 'type', 'entry' and 'mapping' are not supported for JSON bodies")
+				return
+			}
+			if ir.async {
+				badRequest(w, "query param 'async' is not supported for JSON bodies")
+				return
+			}
+		}
+
+		key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+		if len(key) > 255 {
+			badRequest(w, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		if isJSON && key == "" {
+			// json не кладём во временный файл, читаем тело потоком,
+			// контрольную сумму считаем по ходу
+			body := http.MaxBytesReader(w, r.Body, cfg.MaxUploadMB*1024*1024)
+			src := importSource(r, jobs.SourceJSON)
+			h := sha256.New()
+			res, err := runner.Run(r.Context(), &src, ir.opts, func(opts prices.ImportOptions) (prices.ImportResult, error) {
+				res, err := svc.ImportJSON(r.Context(), io.TeeReader(body, h), ndjson, opts)
+				src.Checksum = hex.EncodeToString(h.Sum(nil))
+				return res, err
+			})
+			if err != nil {
+				importFailed(w, err)
+				return
+			}
+			writeImportResult(w, res, ir)
 			return
 		}
 
@@ -24,14 +73,257 @@ func PostPrices(svc *prices.Service, cfg config.Config) http.HandlerFunc {
 			badRequest(w, err.Error())
 			return
 		}
-		defer cleanup()
 
-		res, err := svc.ImportArchive(r.Context(), tempPath, archType)
+		run := func(w http.ResponseWriter) {
+			if isJSON {
+				importJSONFile(w, r, svc, runner, ir, tempPath, cleanup, ndjson)
+				return
+			}
+			importFile(w, r, svc, runner, ir, importSource(r, jobs.SourceUpload), tempPath, cleanup)
+		}
+		if key == "" {
+			run(w)
+			return
+		}
+		withIdempotency(w, r, idem, key, tempPath, cleanup, run)
+	}
+}
+
+// importRequest — параметры импорта плюс то, как вернуть результат.
+type importRequest struct {
+	opts  prices.ImportOptions
+	async bool
+	// не nil при ?rejects=csv: ответ — zip с result.json и rejects.csv
+	rejectsBuf *bytes.Buffer
+}
+
+func parseImportRequest(q url.Values) (importRequest, error) {
+	var ir importRequest
+	var err error
+
+	ir.opts, err = parseImportOptions(q)
+	if err != nil {
+		return ir, err
+	}
+
+	ir.async, err = parseBoolParam(q, "async")
+	if err != nil {
+		return ir, err
+	}
+
+	switch v := strings.ToLower(strings.TrimSpace(q.Get("rejects"))); v {
+	case "":
+	case "csv":
+		if ir.async {
+			return ir, errors.New("query param 'rejects' is not supported with async=true")
+		}
+		ir.rejectsBuf = &bytes.Buffer{}
+		ir.opts.Rejects = prices.NewRejectsWriter(ir.rejectsBuf)
+	default:
+		return ir, errors.New("query param 'rejects' must be 'csv'")
+	}
+
+	return ir, nil
+}
+
+// importFile импортирует загруженный файл сразу или ставит его в очередь.
+// cleanup вызывается здесь же, кроме async: тогда файл удалит воркер.
+// Возвращает true, если импорт выполнен или поставлен в очередь.
+func importFile(w http.ResponseWriter, r *http.Request, svc *prices.Service, runner *jobs.Runner, ir importRequest, src jobs.Source, tempPath string, cleanup func()) bool {
+	var err error
+	if src.Checksum, err = prices.FileSHA256(tempPath); err != nil {
+		cleanup()
+		serverError(w, err.Error())
+		return false
+	}
+
+	if ir.async {
+		job, err := runner.Submit(r.Context(), tempPath, ir.opts, src)
 		if err != nil {
+			cleanup()
 			serverError(w, err.Error())
-			return
+			return false
+		}
+		w.Header().Set("Location", fmt.Sprintf("/api/v0/imports/%d", job.ID))
+		writeJSON(w, http.StatusAccepted, job)
+		return true
+	}
+	defer cleanup()
+
+	res, err := runner.Run(r.Context(), &src, ir.opts, func(opts prices.ImportOptions) (prices.ImportResult, error) {
+		return svc.ImportArchive(r.Context(), tempPath, opts)
+	})
+	if err != nil {
+		importFailed(w, err)
+		return false
+	}
+	writeImportResult(w, res, ir)
+	return true
+}
+
+// parseImportOptions разбирает общие для всех способов загрузки параметры импорта.
+func parseImportOptions(q url.Values) (prices.ImportOptions, error) {
+	var opts prices.ImportOptions
+	var err error
+
+	opts.Type, err = prices.ParseImportType(q.Get("type"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Entries = q["entry"]
+	opts.Sheet = q.Get("sheet")
+	opts.Mapping = q.Get("mapping")
+
+	opts.Source, err = prices.ParseSource(q.Get("source"))
+	if err != nil {
+		return opts, err
+	}
+
+	opts.Encoding, err = prices.ParseEncoding(q.Get("encoding"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Delimiter, err = prices.ParseDelimiter(q.Get("delimiter"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Quote, err = prices.ParseQuote(q.Get("quote"))
+	if err != nil {
+		return opts, err
+	}
+
+	opts.Mode, err = prices.ParseImportMode(q.Get("mode"))
+	if err != nil {
+		return opts, err
+	}
+	if q.Get("key") != "" && opts.Mode != prices.ModeUpsert {
+		return opts, errors.New("query param 'key' is only valid with mode=upsert")
+	}
+	opts.UpsertKey, err = prices.ParseUpsertKey(q.Get("key"))
+	if err != nil {
+		return opts, err
+	}
+
+	opts.DryRun, err = parseBoolParam(q, "dry_run")
+	if err != nil {
+		return opts, err
+	}
+
+	opts.DateLayouts, err = prices.ParseDateLayouts(q["date_format"])
+	if err != nil {
+		return opts, err
+	}
+
+	opts.Price, err = prices.ParsePriceDialect(q.Get("price_profile"), q.Get("decimal_sep"), q.Get("thousands_sep"), q.Get("strip_currency"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Rounding, err = prices.ParseRounding(q.Get("rounding"))
+	if err != nil {
+		return opts, err
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *string
+	}{{"currency", &opts.Currency}, {"totals_currency", &opts.TotalsCurrency}} {
+		if v := q.Get(p.name); v != "" {
+			if *p.dst, err = prices.ParseCurrency(v); err != nil {
+				return opts, fmt.Errorf("query param '%s': %w", p.name, err)
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+func parseBoolParam(q url.Values, name string) (bool, error) {
+	v := q.Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("query param '%s' must be a boolean", name)
+	}
+	return b, nil
+}
+
+// importJSONFile — json-тело, которое пришлось сохранить на диск (ради Idempotency-Key).
+func importJSONFile(w http.ResponseWriter, r *http.Request, svc *prices.Service, runner *jobs.Runner, ir importRequest, tempPath string, cleanup func(), ndjson bool) {
+	defer cleanup()
+
+	src := importSource(r, jobs.SourceJSON)
+	var err error
+	if src.Checksum, err = prices.FileSHA256(tempPath); err != nil {
+		serverError(w, err.Error())
+		return
+	}
+
+	f, err := os.Open(tempPath)
+	if err != nil {
+		serverError(w, err.Error())
+		return
+	}
+	defer f.Close()
+
+	res, err := runner.Run(r.Context(), &src, ir.opts, func(opts prices.ImportOptions) (prices.ImportResult, error) {
+		return svc.ImportJSON(r.Context(), f, ndjson, opts)
+	})
+	if err != nil {
+		importFailed(w, err)
+		return
+	}
+	writeImportResult(w, res, ir)
+}
+
+// importSource: загрузивший — из X-Uploader (его ставит прокси с авторизацией),
+// иначе адрес клиента. Имя файла — из multipart, Content-Disposition или ?filename=.
+func importSource(r *http.Request, kind string) jobs.Source {
+	src := jobs.Source{Kind: kind, Filename: uploadFilename(r)}
+	src.Uploader = strings.TrimSpace(r.Header.Get("X-Uploader"))
+	if src.Uploader == "" {
+		src.Uploader = r.RemoteAddr
+	}
+	return src
+}
+
+func uploadFilename(r *http.Request) string {
+	// форма уже разобрана в ExtractUploadToTempFile; файл ищем так же: сначала "file"
+	if r.MultipartForm != nil {
+		if fhs := r.MultipartForm.File["file"]; len(fhs) > 0 {
+			return path.Base(fhs[0].Filename)
+		}
+		for _, fhs := range r.MultipartForm.File {
+			if len(fhs) > 0 {
+				return path.Base(fhs[0].Filename)
+			}
 		}
+	}
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return path.Base(params["filename"])
+	}
+	return r.URL.Query().Get("filename")
+}
 
+func writeImportResult(w http.ResponseWriter, res prices.ImportResult, ir importRequest) {
+	if ir.rejectsBuf == nil {
 		writeJSON(w, http.StatusOK, res)
+		return
+	}
+
+	if err := ir.opts.Rejects.Flush(); err != nil {
+		serverError(w, err.Error())
+		return
 	}
+	zipBytes, err := prices.ResultZip(res, ir.rejectsBuf.Bytes())
+	if err != nil {
+		serverError(w, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="import.zip"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(zipBytes)
 }
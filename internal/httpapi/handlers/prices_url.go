@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"pricesapi/internal/jobs"
+	"pricesapi/internal/prices"
+)
+
+type importURLRequest struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	SHA256  string            `json:"sha256"`
+}
+
+// ImportFromURL скачивает архив с разрешённого хоста и импортирует его так же,
+// как загруженный файл. Параметры импорта — те же query params.
+func ImportFromURL(svc *prices.Service, runner *jobs.Runner, dl *prices.Downloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ir, err := parseImportRequest(r.URL.Query())
+		if err != nil {
+			badRequest(w, err.Error())
+			return
+		}
+
+		var req importURLRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			badRequest(w, "invalid json body: "+err.Error())
+			return
+		}
+		if strings.TrimSpace(req.URL) == "" {
+			badRequest(w, "field 'url' is required")
+			return
+		}
+
+		tempPath, cleanup, err := dl.Download(r.Context(), req.URL, req.Headers, req.SHA256)
+		if err != nil {
+			importFailed(w, err)
+			return
+		}
+		src := importSource(r, jobs.SourceURL)
+		if u, err := url.Parse(req.URL); err == nil && strings.Trim(u.Path, "/") != "" {
+			src.Filename = path.Base(u.Path)
+		}
+		importFile(w, r, svc, runner, ir, src, tempPath, cleanup)
+	}
+}
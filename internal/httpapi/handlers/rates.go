@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+
+	"pricesapi/internal/config"
+	"pricesapi/internal/prices"
+)
+
+// PostRates принимает csv с курсами (currency, valid_from, rate) —
+// multipart или сырым телом, как и импорт цен.
+func PostRates(svc *prices.Service, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tempPath, cleanup, err := prices.ExtractUploadToTempFile(r, cfg.MaxUploadMB)
+		if err != nil {
+			badRequest(w, err.Error())
+			return
+		}
+		defer cleanup()
+
+		f, err := os.Open(tempPath)
+		if err != nil {
+			serverError(w, err.Error())
+			return
+		}
+		defer f.Close()
+
+		res, err := svc.ImportRates(r.Context(), f)
+		if err != nil {
+			importFailed(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
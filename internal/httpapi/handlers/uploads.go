@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"pricesapi/internal/jobs"
+	"pricesapi/internal/prices"
+	"pricesapi/internal/uploads"
+)
+
+// Докачиваемая загрузка: POST создаёт сессию, PUT ?offset= дописывает чанки,
+// GET/HEAD показывает текущий offset, POST .../finalize запускает импорт.
+
+func CreateUpload(store *uploads.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var size int64
+		if v := r.URL.Query().Get("size"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				badRequest(w, "query param 'size' must be a positive integer")
+				return
+			}
+			size = n
+		}
+
+		sess, err := store.Create(size)
+		if err != nil {
+			uploadFailed(w, err, sess)
+			return
+		}
+
+		w.Header().Set("Location", "/api/v0/uploads/"+sess.ID)
+		writeSession(w, http.StatusCreated, sess)
+	}
+}
+
+func GetUpload(store *uploads.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, err := store.Get(r.PathValue("id"))
+		if err != nil {
+			uploadFailed(w, err, sess)
+			return
+		}
+		writeSession(w, http.StatusOK, sess)
+	}
+}
+
+func PutUploadChunk(store *uploads.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query().Get("offset")
+		if v == "" {
+			v = r.Header.Get("Upload-Offset")
+		}
+		offset, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || offset < 0 {
+			badRequest(w, "chunk offset is required (query param 'offset' or Upload-Offset header)")
+			return
+		}
+
+		sess, err := store.Append(r.PathValue("id"), offset, r.Body)
+		if err != nil {
+			uploadFailed(w, err, sess)
+			return
+		}
+		writeSession(w, http.StatusOK, sess)
+	}
+}
+
+func DeleteUpload(store *uploads.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := store.Delete(r.PathValue("id")); err != nil {
+			uploadFailed(w, err, uploads.Session{})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// FinalizeUpload принимает те же параметры импорта, что и POST /api/v0/prices.
+func FinalizeUpload(svc *prices.Service, runner *jobs.Runner, store *uploads.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ir, err := parseImportRequest(r.URL.Query())
+		if err != nil {
+			badRequest(w, err.Error())
+			return
+		}
+
+		id := r.PathValue("id")
+		tempPath, cleanup, err := store.Finalize(id)
+		if err != nil {
+			uploadFailed(w, err, uploads.Session{})
+			return
+		}
+
+		// при ошибке или dry run сессия остаётся, загрузку можно финализировать снова
+		imported := false
+		defer func() { store.Release(id, imported && !ir.opts.DryRun) }()
+		imported = importFile(w, r, svc, runner, ir, importSource(r, jobs.SourceChunked), tempPath, cleanup)
+	}
+}
+
+func writeSession(w http.ResponseWriter, status int, sess uploads.Session) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(sess.Offset, 10))
+	writeJSON(w, status, sess)
+}
+
+func uploadFailed(w http.ResponseWriter, err error, sess uploads.Session) {
+	switch {
+	case errors.Is(err, uploads.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, apiError{Error: err.Error()})
+	case errors.Is(err, uploads.ErrOffsetMismatch):
+		// клиенту нужен актуальный offset, чтобы продолжить
+		w.Header().Set("Upload-Offset", strconv.FormatInt(sess.Offset, 10))
+		writeJSON(w, http.StatusConflict, apiError{Error: fmt.Sprintf("%s: expected offset %d", err, sess.Offset)})
+	case errors.Is(err, uploads.ErrIncomplete), errors.Is(err, uploads.ErrFinalizing):
+		writeJSON(w, http.StatusConflict, apiError{Error: err.Error()})
+	case errors.Is(err, uploads.ErrTooLarge):
+		writeJSON(w, http.StatusRequestEntityTooLarge, apiError{Error: err.Error()})
+	default:
+		serverError(w, err.Error())
+	}
+}
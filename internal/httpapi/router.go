@@ -5,25 +5,24 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgxpool"
-
 	"pricesapi/internal/config"
 	"pricesapi/internal/httpapi/handlers"
+	"pricesapi/internal/idempotency"
+	"pricesapi/internal/jobs"
 	"pricesapi/internal/prices"
+	"pricesapi/internal/uploads"
 )
 
-func NewRouter(pool *pgxpool.Pool, logger *slog.Logger, cfg config.Config) http.Handler {
+func NewRouter(svc *prices.Service, runner *jobs.Runner, store *uploads.Store, idem *idempotency.Store, logger *slog.Logger, cfg config.Config) http.Handler {
 	mux := http.NewServeMux()
 
 // проверочка, жив ли вообще сайт
 	mux.HandleFunc("/health", handlers.Health)
 
-	svc := prices.NewService(pool, logger)
-
 	mux.HandleFunc("/api/v0/prices", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
-			handlers.PostPrices(svc, cfg)(w, r)
+			handlers.PostPrices(svc, runner, idem, cfg)(w, r)
 		case http.MethodGet:
 			handlers.GetPrices(svc)(w, r)
 		default:
@@ -31,6 +30,98 @@ func NewRouter(pool *pgxpool.Pool, logger *slog.Logger, cfg config.Config) http.
 		}
 	})
 
+	mux.HandleFunc("/api/v0/rates", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			handlers.PostRates(svc, cfg)(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v0/mappings", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handlers.ListMappings(svc)(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v0/mappings/{name}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handlers.GetMapping(svc)(w, r)
+		case http.MethodPut:
+			handlers.PutMapping(svc)(w, r)
+		case http.MethodDelete:
+			handlers.DeleteMapping(svc)(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	dl := prices.NewDownloader(cfg.ImportURLAllowedHosts, cfg.MaxUploadMB)
+	mux.HandleFunc("/api/v0/prices/url", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			handlers.ImportFromURL(svc, runner, dl)(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v0/imports", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handlers.ListImports(runner)(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v0/imports/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handlers.GetImport(runner)(w, r)
+		case http.MethodDelete:
+			handlers.DeleteImport(runner)(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v0/uploads", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			handlers.CreateUpload(store)(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v0/uploads/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			handlers.GetUpload(store)(w, r)
+		case http.MethodPut, http.MethodPatch:
+			handlers.PutUploadChunk(store)(w, r)
+		case http.MethodDelete:
+			handlers.DeleteUpload(store)(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/api/v0/uploads/{id}/finalize", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			handlers.FinalizeUpload(svc, runner, store)(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
 	return withMiddlewares(mux, logger, 60*time.Second)
 }
 
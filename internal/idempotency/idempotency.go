@@ -0,0 +1,105 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrKeyReused  = errors.New("idempotency key was already used with a different request")
+	ErrInProgress = errors.New("request with this idempotency key is still in progress")
+)
+
+const (
+	// сколько помним ключ
+	keyTTL = 24 * time.Hour
+	// незавершённый запрос старше этого считаем брошенным (сервер упал посреди импорта)
+	abandonAfter = 15 * time.Minute
+)
+
+// Response — сохранённый ответ, который отдаём при повторе.
+type Response struct {
+	Status      int
+	ContentType string
+	Headers     map[string]string
+	Body        []byte
+}
+
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+// Begin резервирует ключ за запросом с данным отпечатком. Если ключ уже
+// отработал с тем же отпечатком — возвращает сохранённый ответ.
+func (s *Store) Begin(ctx context.Context, key, fingerprint string) (*Response, error) {
+	if _, err := s.pool.Exec(ctx, `
+DELETE FROM idempotency_keys
+WHERE created_at < now() - $1 * interval '1 second'
+   OR (key = $2 AND completed_at IS NULL AND created_at < now() - $3 * interval '1 second');`,
+		int64(keyTTL.Seconds()), key, int64(abandonAfter.Seconds())); err != nil {
+		return nil, fmt.Errorf("purge idempotency keys: %w", err)
+	}
+
+	tag, err := s.pool.Exec(ctx, `
+INSERT INTO idempotency_keys(key, fingerprint)
+VALUES ($1, $2)
+ON CONFLICT (key) DO NOTHING;`, key, fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("reserve idempotency key: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		return nil, nil
+	}
+
+	var storedFP string
+	var status *int
+	var resp Response
+	err = s.pool.QueryRow(ctx, `
+SELECT fingerprint, status, content_type, headers, body
+FROM idempotency_keys WHERE key = $1;`, key).Scan(&storedFP, &status, &resp.ContentType, &resp.Headers, &resp.Body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// ключ успели удалить между INSERT и SELECT — просто пробуем снова
+		return s.Begin(ctx, key, fingerprint)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load idempotency key: %w", err)
+	}
+
+	if storedFP != fingerprint {
+		return nil, ErrKeyReused
+	}
+	if status == nil {
+		return nil, ErrInProgress
+	}
+	resp.Status = *status
+	return &resp, nil
+}
+
+func (s *Store) Complete(ctx context.Context, key string, resp Response) error {
+	_, err := s.pool.Exec(ctx, `
+UPDATE idempotency_keys
+SET status = $2, content_type = $3, headers = $4, body = $5, completed_at = now()
+WHERE key = $1;`, key, resp.Status, resp.ContentType, resp.Headers, resp.Body)
+	if err != nil {
+		return fmt.Errorf("save idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Abort освобождает ключ, чтобы запрос можно было повторить (например, после 5xx).
+func (s *Store) Abort(ctx context.Context, key string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND completed_at IS NULL;`, key)
+	if err != nil {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,491 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"pricesapi/internal/prices"
+)
+
+// Состояния задачи импорта.
+const (
+	StateQueued    = "queued"
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+)
+
+var ErrNotFound = errors.New("import job not found")
+
+// Источники импорта.
+const (
+	SourceUpload  = "upload"
+	SourceJSON    = "json"
+	SourceURL     = "url"
+	SourceChunked = "chunked"
+)
+
+// Source — откуда пришёл файл импорта.
+type Source struct {
+	Kind     string
+	Filename string
+	// hex sha256 загруженного файла
+	Checksum string
+	Uploader string
+}
+
+// Job — запись в imports. Async=false — импорт выполнен в запросе,
+// запись только для истории.
+type Job struct {
+	ID            int64                `json:"id"`
+	State         string               `json:"state"`
+	Async         bool                 `json:"async"`
+	Source        string               `json:"source"`
+	Filename      string               `json:"filename,omitempty"`
+	Checksum      string               `json:"checksum,omitempty"`
+	Uploader      string               `json:"uploader,omitempty"`
+	Entries       []string             `json:"entries"`
+	Attempts      int                  `json:"attempts"`
+	RowsProcessed int64                `json:"rows_processed"`
+	Counts        *Counts              `json:"counts,omitempty"`
+	Result        *prices.ImportResult `json:"result"`
+	Error         string               `json:"error,omitempty"`
+	ErrorCode     string               `json:"error_code,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	StartedAt     *time.Time           `json:"started_at"`
+	FinishedAt    *time.Time           `json:"finished_at"`
+	// строки импорта удалены через DELETE /api/v0/imports/{id}
+	UndoneAt *time.Time `json:"undone_at,omitempty"`
+}
+
+// Counts — итоговые счётчики успешного импорта.
+type Counts struct {
+	Total      int64 `json:"total"`
+	Inserted   int64 `json:"inserted"`
+	Updated    int64 `json:"updated"`
+	Duplicates int64 `json:"duplicates"`
+	Rejected   int64 `json:"rejected"`
+}
+
+// ListFilter — страница списка импортов, от новых к старым.
+type ListFilter struct {
+	Limit int
+	// только импорты с id меньше этого; 0 — с самого нового
+	BeforeID int64
+	State    string
+}
+
+// Runner выполняет импорты в фоне. Задачи лежат в таблице imports, так что
+// переживают рестарт: незавершённые снова ставятся в очередь при Start.
+type Runner struct {
+	pool    *pgxpool.Pool
+	svc     *prices.Service
+	logger  *slog.Logger
+	workers int
+
+	wake chan struct{}
+	wg   sync.WaitGroup
+}
+
+const (
+	pollInterval     = 5 * time.Second
+	progressInterval = time.Second
+	// задача, прерванная столько раз (падение процесса посреди импорта),
+	// скорее всего сама его и роняет — больше не перезапускаем
+	maxAttempts = 3
+)
+
+// Код ошибки задачи, которую прервали и больше не перезапускают.
+const CodeInterrupted = "interrupted"
+
+func NewRunner(pool *pgxpool.Pool, svc *prices.Service, logger *slog.Logger, workers int) *Runner {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &Runner{
+		pool:    pool,
+		svc:     svc,
+		logger:  logger,
+		workers: workers,
+		wake:    make(chan struct{}, workers),
+	}
+}
+
+// Start возвращает прерванные задачи в очередь и запускает воркеры.
+// Воркеры останавливаются при отмене ctx; Wait дожидается их.
+func (r *Runner) Start(ctx context.Context) error {
+	// синхронный импорт выполнялся в запросе: файла нет, клиент получил ошибку
+	if _, err := r.pool.Exec(ctx, `
+UPDATE imports SET state = $1, error = $3, error_code = $4, finished_at = now()
+WHERE state = $2 AND NOT async;`, StateFailed, StateRunning,
+		"import was interrupted by a server restart", CodeInterrupted); err != nil {
+		return fmt.Errorf("fail interrupted imports: %w", err)
+	}
+
+	// транзакция импорта при падении откатилась, так что перезапуск безопасен
+	if _, err := r.pool.Exec(ctx, `
+UPDATE imports SET state = $1, started_at = NULL
+WHERE state = $2 AND async AND attempts < $3;`, StateQueued, StateRunning, maxAttempts); err != nil {
+		return fmt.Errorf("requeue jobs: %w", err)
+	}
+	if _, err := r.pool.Exec(ctx, `
+UPDATE imports SET state = $1, error = $3, error_code = $4, finished_at = now()
+WHERE state = $2;`, StateFailed, StateRunning,
+		fmt.Sprintf("import was interrupted %d times, not restarting it", maxAttempts), CodeInterrupted); err != nil {
+		return fmt.Errorf("fail interrupted jobs: %w", err)
+	}
+
+	for i := 0; i < r.workers; i++ {
+		r.wg.Add(1)
+		go r.work(ctx)
+	}
+	return nil
+}
+
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// Submit ставит загруженный файл в очередь. Файл переходит во владение
+// Runner и удаляется после завершения задачи.
+func (r *Runner) Submit(ctx context.Context, uploadPath string, opts prices.ImportOptions, src Source) (Job, error) {
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return Job{}, fmt.Errorf("encode options: %w", err)
+	}
+
+	var id int64
+	if err := r.pool.QueryRow(ctx, `
+INSERT INTO imports(state, options, upload_path, source, filename, checksum, uploader)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id;`, StateQueued, optsJSON, uploadPath, src.Kind, src.Filename, src.Checksum, src.Uploader).Scan(&id); err != nil {
+		return Job{}, fmt.Errorf("insert job: %w", err)
+	}
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+
+	return r.Get(ctx, id)
+}
+
+// Run выполняет импорт в запросе и записывает его в imports, чтобы
+// синхронные импорты были в истории наравне с async. Dry run не записывается:
+// он ничего не меняет в prices. fn может дописать src.Checksum, если он
+// считается по ходу чтения.
+func (r *Runner) Run(ctx context.Context, src *Source, opts prices.ImportOptions, fn func(prices.ImportOptions) (prices.ImportResult, error)) (prices.ImportResult, error) {
+	if opts.DryRun {
+		return fn(opts)
+	}
+
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return prices.ImportResult{}, fmt.Errorf("encode options: %w", err)
+	}
+	var id int64
+	if err := r.pool.QueryRow(ctx, `
+INSERT INTO imports(state, options, async, source, filename, checksum, uploader, started_at)
+VALUES ($1, $2, false, $3, $4, $5, $6, now())
+RETURNING id;`, StateRunning, optsJSON, src.Kind, src.Filename, src.Checksum, src.Uploader).Scan(&id); err != nil {
+		return prices.ImportResult{}, fmt.Errorf("insert import: %w", err)
+	}
+
+	opts.ImportID = id
+	// при панике запись не должна остаться running; саму панику отдаём Recoverer
+	defer func() {
+		if v := recover(); v != nil {
+			if err := r.finish(id, nil, fmt.Errorf("panic: %v", v), src.Checksum); err != nil {
+				r.logger.Warn("record import failed", "id", id, "err", err)
+			}
+			panic(v)
+		}
+	}()
+	res, runErr := fn(opts)
+	if runErr != nil {
+		if err := r.finish(id, nil, runErr, src.Checksum); err != nil {
+			r.logger.Warn("record import failed", "id", id, "err", err)
+		}
+		return res, runErr
+	}
+	res.ImportID = id
+	if err := r.finish(id, &res, nil, src.Checksum); err != nil {
+		r.logger.Warn("record import failed", "id", id, "err", err)
+	}
+	return res, nil
+}
+
+// result в списке не отдаём: он бывает большим, детали — в Get.
+const jobSelect = `
+SELECT id, state, async, source, filename, checksum, uploader, entries, attempts, rows_processed,
+  total_count, inserted_count, updated_count, duplicates_count, rejected_count,
+  %s, error, error_code, created_at, started_at, finished_at, undone_at
+FROM imports`
+
+func (r *Runner) Get(ctx context.Context, id int64) (Job, error) {
+	j, err := scanJob(r.pool.QueryRow(ctx, fmt.Sprintf(jobSelect, "result")+` WHERE id = $1;`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+	if err != nil {
+		return Job{}, fmt.Errorf("get job: %w", err)
+	}
+	return j, nil
+}
+
+// UploadInUse — файл ещё нужен задаче, ждущей в очереди или идущей сейчас.
+func (r *Runner) UploadInUse(ctx context.Context, path string) (bool, error) {
+	var used bool
+	err := r.pool.QueryRow(ctx, `
+SELECT EXISTS (SELECT 1 FROM imports WHERE upload_path = $1 AND state IN ($2, $3));`,
+		path, StateQueued, StateRunning).Scan(&used)
+	if err != nil {
+		return false, fmt.Errorf("check upload in use: %w", err)
+	}
+	return used, nil
+}
+
+// List возвращает импорты от новых к старым.
+func (r *Runner) List(ctx context.Context, f ListFilter) ([]Job, error) {
+	rows, err := r.pool.Query(ctx, fmt.Sprintf(jobSelect, "NULL::jsonb")+`
+WHERE ($1 = 0 OR id < $1) AND ($2 = '' OR state = $2)
+ORDER BY id DESC
+LIMIT $3;`, f.BeforeID, f.State, f.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	list := []Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("list jobs: %w", err)
+		}
+		list = append(list, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list jobs: %w", err)
+	}
+	return list, nil
+}
+
+func scanJob(row pgx.Row) (Job, error) {
+	var j Job
+	var resultJSON []byte
+	var errText, errCode *string
+	var total, inserted, updated, duplicates, rejected *int64
+	if err := row.Scan(
+		&j.ID, &j.State, &j.Async, &j.Source, &j.Filename, &j.Checksum, &j.Uploader, &j.Entries, &j.Attempts, &j.RowsProcessed,
+		&total, &inserted, &updated, &duplicates, &rejected,
+		&resultJSON, &errText, &errCode, &j.CreatedAt, &j.StartedAt, &j.FinishedAt, &j.UndoneAt,
+	); err != nil {
+		return Job{}, err
+	}
+
+	if total != nil {
+		j.Counts = &Counts{Total: *total}
+		for _, c := range []struct {
+			src *int64
+			dst *int64
+		}{{inserted, &j.Counts.Inserted}, {updated, &j.Counts.Updated}, {duplicates, &j.Counts.Duplicates}, {rejected, &j.Counts.Rejected}} {
+			if c.src != nil {
+				*c.dst = *c.src
+			}
+		}
+	}
+	if resultJSON != nil {
+		var res prices.ImportResult
+		if err := json.Unmarshal(resultJSON, &res); err != nil {
+			return Job{}, fmt.Errorf("decode job result: %w", err)
+		}
+		j.Result = &res
+	}
+	if errText != nil {
+		j.Error = *errText
+	}
+	if errCode != nil {
+		j.ErrorCode = *errCode
+	}
+	return j, nil
+}
+
+func (r *Runner) work(ctx context.Context) {
+	defer r.wg.Done()
+
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+
+	for {
+		// выгребаем очередь, пока есть задачи
+		for {
+			ran, err := r.runNext(ctx)
+			if err != nil && ctx.Err() == nil {
+				r.logger.Error("import job failed to run", "err", err)
+			}
+			if !ran || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-t.C:
+		}
+	}
+}
+
+func (r *Runner) runNext(ctx context.Context) (bool, error) {
+	var id int64
+	var optsJSON []byte
+	var uploadPath, checksum string
+	err := r.pool.QueryRow(ctx, `
+UPDATE imports SET state = $1, started_at = now(), attempts = attempts + 1
+WHERE id = (
+  SELECT id FROM imports
+  WHERE state = $2
+  ORDER BY id
+  FOR UPDATE SKIP LOCKED
+  LIMIT 1
+)
+RETURNING id, options, upload_path, checksum;`, StateRunning, StateQueued).Scan(&id, &optsJSON, &uploadPath, &checksum)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("claim job: %w", err)
+	}
+
+	var opts prices.ImportOptions
+	if err := json.Unmarshal(optsJSON, &opts); err != nil {
+		return true, r.finish(id, nil, fmt.Errorf("decode options: %w", err), checksum)
+	}
+	if _, err := os.Stat(uploadPath); err != nil {
+		return true, r.finish(id, nil, fmt.Errorf("upload file is gone: %w", err), checksum)
+	}
+
+	var progress atomic.Int64
+	opts.Progress = &progress
+	opts.ImportID = id
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.trackProgress(ctx, id, &progress, stop)
+	}()
+
+	r.logger.Info("import job started", "id", id)
+	res, runErr := r.importArchive(ctx, id, uploadPath, opts)
+	close(stop)
+	<-done
+
+	// при остановке сервера задача остаётся running и перезапустится при старте
+	if ctx.Err() != nil {
+		return true, ctx.Err()
+	}
+
+	_ = os.Remove(uploadPath)
+	if err := r.saveProgress(context.Background(), id, progress.Load()); err != nil {
+		r.logger.Warn("save job progress failed", "id", id, "err", err)
+	}
+	if runErr != nil {
+		r.logger.Warn("import job failed", "id", id, "err", runErr)
+		return true, r.finish(id, nil, runErr, checksum)
+	}
+	r.logger.Info("import job finished", "id", id, "total_items", res.TotalItems)
+	res.ImportID = id
+	return true, r.finish(id, &res, nil, checksum)
+}
+
+// importArchive: паника в импорте валит только эту задачу, а не весь процесс
+// (у HTTP-обработчиков то же делает Recoverer).
+func (r *Runner) importArchive(ctx context.Context, id int64, uploadPath string, opts prices.ImportOptions) (res prices.ImportResult, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			r.logger.Error("import job panicked", "id", id, "panic", v, "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	return r.svc.ImportArchive(ctx, uploadPath, opts)
+}
+
+func (r *Runner) trackProgress(ctx context.Context, id int64, progress *atomic.Int64, stop <-chan struct{}) {
+	t := time.NewTicker(progressInterval)
+	defer t.Stop()
+
+	var last int64
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			n := progress.Load()
+			if n == last {
+				continue
+			}
+			if err := r.saveProgress(ctx, id, n); err != nil {
+				r.logger.Warn("save job progress failed", "id", id, "err", err)
+				continue
+			}
+			last = n
+		}
+	}
+}
+
+func (r *Runner) saveProgress(ctx context.Context, id, rows int64) error {
+	_, err := r.pool.Exec(ctx, `UPDATE imports SET rows_processed = $2 WHERE id = $1;`, id, rows)
+	return err
+}
+
+// finish записывает итог задачи. checksum пишется заново: у json, прочитанного
+// потоком, он известен только после импорта.
+func (r *Runner) finish(id int64, res *prices.ImportResult, runErr error, checksum string) error {
+	// результат записываем даже если сервер уже останавливается
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if runErr != nil {
+		code := ""
+		var ie *prices.ImportError
+		if errors.As(runErr, &ie) {
+			code = ie.Code
+		}
+		_, err := r.pool.Exec(ctx, `
+UPDATE imports SET state = $2, error = $3, error_code = NULLIF($4, ''), checksum = $5, finished_at = now()
+WHERE id = $1;`, id, StateFailed, runErr.Error(), code, checksum)
+		return err
+	}
+
+	resultJSON, err := json.Marshal(res)
+	if err != nil {
+		return fmt.Errorf("encode job result: %w", err)
+	}
+	entries := make([]string, 0, len(res.Files))
+	for _, f := range res.Files {
+		entries = append(entries, f.Entry)
+	}
+	_, err = r.pool.Exec(ctx, `
+UPDATE imports SET state = $2, result = $3, checksum = $4, entries = $5,
+  rows_processed = GREATEST(rows_processed, $6),
+  total_count = $6, inserted_count = $7, updated_count = $8, duplicates_count = $9, rejected_count = $10,
+  finished_at = now()
+WHERE id = $1;`, id, StateSucceeded, resultJSON, checksum, entries,
+		res.TotalCount, res.TotalItems, res.UpdatedCount, res.DuplicatesCount, res.RejectedCount)
+	return err
+}
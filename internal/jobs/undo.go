@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrNotUndoable   = errors.New("only a succeeded import can be undone")
+	ErrAlreadyUndone = errors.New("import is already undone")
+	// строки импорта потом обновлены другими импортами (upsert)
+	ErrDependentImports = errors.New("rows of this import were updated by later imports")
+)
+
+// UndoResult — что удалил (или удалил бы) откат импорта.
+type UndoResult struct {
+	ImportID int64 `json:"import_id"`
+	Removed  int64 `json:"removed"`
+	// удалено по файлам архива; json-тело — под ""
+	RemovedByEntry map[string]int64 `json:"removed_by_entry"`
+
+	// импорты, которые последними обновили строки этого импорта, и сколько таких строк
+	DependentImports []int64 `json:"dependent_imports"`
+	DependentRows    int64   `json:"dependent_rows"`
+	// строки других импортов, которые этот импорт обновил: старую цену
+	// не храним, поэтому они остаются как есть
+	UpdatedNotReverted int64 `json:"updated_not_reverted"`
+
+	Forced   bool     `json:"forced"`
+	Warnings []string `json:"warnings"`
+}
+
+// Undo удаляет строки prices, вставленные импортом, одной транзакцией.
+// Если их потом обновляли другие импорты, без force ничего не удаляет и
+// возвращает ErrDependentImports вместе с заполненным UndoResult.
+func (r *Runner) Undo(ctx context.Context, id int64, force bool) (UndoResult, error) {
+	res := UndoResult{ImportID: id, RemovedByEntry: map[string]int64{}, DependentImports: []int64{}, Warnings: []string{}, Forced: force}
+
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return res, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var state string
+	var undoneAt *time.Time
+	err = tx.QueryRow(ctx, `SELECT state, undone_at FROM imports WHERE id = $1 FOR UPDATE;`, id).Scan(&state, &undoneAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return res, ErrNotFound
+	}
+	if err != nil {
+		return res, fmt.Errorf("lock import: %w", err)
+	}
+	if undoneAt != nil {
+		return res, ErrAlreadyUndone
+	}
+	if state != StateSucceeded {
+		return res, ErrNotUndoable
+	}
+
+	// блокируем строки, чтобы их не обновил импорт, идущий параллельно
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM prices WHERE import_id = $1 FOR UPDATE;`, id); err != nil {
+		return res, fmt.Errorf("lock rows: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+SELECT updated_import_id, COUNT(*)
+FROM prices
+WHERE import_id = $1 AND updated_import_id IS NOT NULL AND updated_import_id <> $1
+GROUP BY updated_import_id
+ORDER BY updated_import_id;`, id)
+	if err != nil {
+		return res, fmt.Errorf("find dependent imports: %w", err)
+	}
+	for rows.Next() {
+		var dep, n int64
+		if err := rows.Scan(&dep, &n); err != nil {
+			rows.Close()
+			return res, fmt.Errorf("find dependent imports: %w", err)
+		}
+		res.DependentImports = append(res.DependentImports, dep)
+		res.DependentRows += n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, fmt.Errorf("find dependent imports: %w", err)
+	}
+
+	if err := tx.QueryRow(ctx, `
+SELECT COUNT(*) FROM prices
+WHERE updated_import_id = $1 AND import_id IS DISTINCT FROM $1;`, id).Scan(&res.UpdatedNotReverted); err != nil {
+		return res, fmt.Errorf("count updated rows: %w", err)
+	}
+	if res.UpdatedNotReverted > 0 {
+		res.Warnings = append(res.Warnings, fmt.Sprintf("%d rows of earlier imports were updated by this import and keep the updated price", res.UpdatedNotReverted))
+	}
+
+	if res.DependentRows > 0 {
+		if !force {
+			return res, ErrDependentImports
+		}
+		res.Warnings = append(res.Warnings, fmt.Sprintf("%d removed rows were later updated by imports %v", res.DependentRows, res.DependentImports))
+	}
+
+	rows, err = tx.Query(ctx, `
+WITH del AS (
+  DELETE FROM prices WHERE import_id = $1
+  RETURNING source_entry
+)
+SELECT COALESCE(source_entry, ''), COUNT(*) FROM del GROUP BY 1 ORDER BY 1;`, id)
+	if err != nil {
+		return res, fmt.Errorf("delete rows: %w", err)
+	}
+	for rows.Next() {
+		var entry string
+		var n int64
+		if err := rows.Scan(&entry, &n); err != nil {
+			rows.Close()
+			return res, fmt.Errorf("delete rows: %w", err)
+		}
+		res.RemovedByEntry[entry] = n
+		res.Removed += n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, fmt.Errorf("delete rows: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE imports SET undone_at = now() WHERE id = $1;`, id); err != nil {
+		return res, fmt.Errorf("mark import undone: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return res, fmt.Errorf("commit: %w", err)
+	}
+
+	r.logger.Info("import undone", "id", id, "removed", res.Removed, "forced", force)
+	return res, nil
+}
@@ -0,0 +1,172 @@
+package prices
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Service) importZip(ctx context.Context, tx pgx.Tx, tempFilePath string, guard *archiveGuard, opts ImportOptions, res *ImportResult) error {
+	zr, err := zip.OpenReader(tempFilePath)
+	if err != nil {
+		return fmt.Errorf("open zip: %w", err)
+	}
+	defer zr.Close()
+
+	if err := guard.zipEntries(&zr.Reader); err != nil {
+		return err
+	}
+
+	sel := newEntrySelector(opts.Entries)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := cleanEntryName(f.Name)
+		if !sel.match(name) {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("zip open %s: %w", name, err)
+		}
+		err = s.importCSV(ctx, tx, name, guard.reader(rc), opts, res)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return sel.check("zip")
+}
+
+func (s *Service) importTar(ctx context.Context, tx pgx.Tx, tempFilePath, format string, guard *archiveGuard, opts ImportOptions, res *ImportResult) error {
+	f, err := os.Open(tempFilePath)
+	if err != nil {
+		return fmt.Errorf("open tar file: %w", err)
+	}
+	defer f.Close()
+
+	dr, closeFn, err := decompressReader(bufio.NewReader(f), format)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	// считаем весь распакованный поток: пропущенные записи тоже распаковываются
+	tr := tar.NewReader(guard.reader(dr))
+
+	sel := newEntrySelector(opts.Entries)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var ie *ImportError
+			if errors.As(err, &ie) {
+				return err
+			}
+			return fmt.Errorf("tar read: %w", err)
+		}
+		if err := guard.entry(hdr.Name); err != nil {
+			return err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		name := cleanEntryName(hdr.Name)
+		if !sel.match(name) {
+			continue
+		}
+		if err := s.importCSV(ctx, tx, name, tr, opts, res); err != nil {
+			return err
+		}
+	}
+	return sel.check("tar")
+}
+
+// importPlain грузит одиночный csv, возможно сжатый gzip или bzip2.
+func (s *Service) importPlain(ctx context.Context, tx pgx.Tx, tempFilePath, format string, guard *archiveGuard, opts ImportOptions, res *ImportResult) error {
+	if len(opts.Entries) > 0 {
+		return importErrorf(CodeEntryNotFound, "%s: 'entry' can only be used with zip or tar archives", format)
+	}
+
+	f, err := os.Open(tempFilePath)
+	if err != nil {
+		return fmt.Errorf("open upload: %w", err)
+	}
+	defer f.Close()
+
+	r, closeFn, err := decompressReader(bufio.NewReader(f), format)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	return s.importCSV(ctx, tx, "", guard.reader(r), opts, res)
+}
+
+// entrySelector решает, какие файлы архива импортировать: либо все .csv,
+// либо только явно перечисленные в ?entry=.
+type entrySelector struct {
+	want    map[string]bool
+	seen    map[string]bool
+	matched int
+}
+
+func newEntrySelector(entries []string) *entrySelector {
+	es := &entrySelector{seen: map[string]bool{}}
+	if len(entries) > 0 {
+		es.want = map[string]bool{}
+		for _, e := range entries {
+			es.want[cleanEntryName(e)] = true
+		}
+	}
+	return es
+}
+
+func (es *entrySelector) match(name string) bool {
+	if es.want != nil {
+		if !es.want[name] {
+			return false
+		}
+	} else {
+		// служебный мусор от macOS архиватора
+		if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), "._") {
+			return false
+		}
+		if !strings.HasSuffix(strings.ToLower(name), ".csv") {
+			return false
+		}
+	}
+	es.seen[name] = true
+	es.matched++
+	return true
+}
+
+func (es *entrySelector) check(kind string) error {
+	for name := range es.want {
+		if !es.seen[name] {
+			return importErrorf(CodeEntryNotFound, "%s: entry %q not found", kind, name)
+		}
+	}
+	if es.matched == 0 {
+		return importErrorf(CodeNoCSV, "%s: no .csv file found", kind)
+	}
+	return nil
+}
+
+func cleanEntryName(name string) string {
+	name = strings.ReplaceAll(name, `\`, "/")
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
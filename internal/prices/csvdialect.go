@@ -0,0 +1,159 @@
+package prices
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CSVDialect — с какими разделителем и кавычкой прочитан csv.
+type CSVDialect struct {
+	Delimiter string `json:"delimiter"`
+	Quote     string `json:"quote"`
+	// разделитель определён по содержимому, а не задан параметром
+	Detected bool `json:"detected"`
+}
+
+// Кандидаты в порядке приоритета при равном счёте.
+var delimiterCandidates = []byte{',', ';', '\t', '|'}
+
+// Сколько записей из начала файла смотрим при определении разделителя.
+const (
+	sniffRecords     = 20
+	sniffDialectSize = 64 * 1024
+)
+
+// ParseDelimiter: пусто или auto — определить по файлу.
+func ParseDelimiter(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return "", nil
+	case ",", "comma":
+		return ",", nil
+	case ";", "semicolon":
+		return ";", nil
+	case "\t", `\t`, "tab":
+		return "\t", nil
+	case "|", "pipe":
+		return "|", nil
+	default:
+		return "", fmt.Errorf("query param 'delimiter' must be one of: auto, comma, semicolon, tab, pipe")
+	}
+}
+
+// ParseQuote: encoding/csv знает только '"', одинарную кавычку
+// поддерживаем подменой байтов (см. swapReader).
+func ParseQuote(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case "", `"`, "double":
+		return `"`, nil
+	case "'", "single":
+		return "'", nil
+	default:
+		return "", fmt.Errorf("query param 'quote' must be one of: double, single")
+	}
+}
+
+// sniffDelimiter выбирает разделитель, который встречается одинаковое
+// ненулевое число раз во всех записях начала файла. Если такого нет —
+// самый частый в заголовке, иначе запятая.
+func sniffDelimiter(sample []byte, quote byte, truncated bool) string {
+	type counts [4]int
+	var records []counts
+	var cur counts
+	empty := true
+	inQuote := false
+	for _, c := range sample {
+		if c == quote {
+			inQuote = !inQuote
+		}
+		if inQuote {
+			continue
+		}
+		if c == '\n' {
+			if !empty {
+				records = append(records, cur)
+			}
+			cur, empty = counts{}, true
+			if len(records) == sniffRecords {
+				break
+			}
+			continue
+		}
+		if c != '\r' && c != ' ' {
+			empty = false
+		}
+		for i, d := range delimiterCandidates {
+			if c == d {
+				cur[i]++
+			}
+		}
+	}
+	// последняя запись могла обрезаться на границе выборки
+	if !empty && !truncated && len(records) < sniffRecords {
+		records = append(records, cur)
+	}
+	if len(records) == 0 {
+		return ","
+	}
+
+	best, bestN := -1, 0
+	for i := range delimiterCandidates {
+		n := records[0][i]
+		consistent := n > 0
+		for _, r := range records[1:] {
+			if r[i] != n {
+				consistent = false
+				break
+			}
+		}
+		if consistent && n > bestN {
+			best, bestN = i, n
+		}
+	}
+	if best < 0 {
+		for i := range delimiterCandidates {
+			if records[0][i] > bestN {
+				best, bestN = i, records[0][i]
+			}
+		}
+	}
+	if best < 0 {
+		return ","
+	}
+	return string(delimiterCandidates[best])
+}
+
+// swapReader меняет местами два однобайтовых символа. Так csv с кавычкой '
+// читается стандартным csv.Reader; значения потом меняются обратно.
+type swapReader struct {
+	r    io.Reader
+	a, b byte
+}
+
+func (s *swapReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	for i, c := range p[:n] {
+		switch c {
+		case s.a:
+			p[i] = s.b
+		case s.b:
+			p[i] = s.a
+		}
+	}
+	return n, err
+}
+
+func swapFields(rec []string, a, b byte) {
+	for i, v := range rec {
+		rec[i] = strings.Map(func(r rune) rune {
+			switch r {
+			case rune(a):
+				return rune(b)
+			case rune(b):
+				return rune(a)
+			}
+			return r
+		}, v)
+	}
+}
@@ -0,0 +1,143 @@
+package prices
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultCurrency — валюта строк без колонки currency и базовая валюта
+// курсов: currency_rates.rate — сколько DefaultCurrency стоит 1 единица валюты.
+const DefaultCurrency = "RUB"
+
+var currencyCodeRe = regexp.MustCompile(`^[A-Z]{3}$`)
+
+var errBadCurrency = errors.New("currency must be a 3-letter ISO 4217 code")
+
+// ParseCurrency приводит код к верхнему регистру и проверяет формат.
+func ParseCurrency(s string) (string, error) {
+	c := strings.ToUpper(strings.TrimSpace(s))
+	if !currencyCodeRe.MatchString(c) {
+		return "", errBadCurrency
+	}
+	return c, nil
+}
+
+// rateSQL — курс валюты cur к DefaultCurrency, действующий на дату d;
+// NULL, если курса на эту дату нет.
+func rateSQL(cur, d string) string {
+	return fmt.Sprintf(`CASE WHEN %[1]s = '%[3]s' THEN 1 ELSE (
+  SELECT cr.rate FROM currency_rates cr
+  WHERE cr.currency = %[1]s AND cr.valid_from <= %[2]s
+  ORDER BY cr.valid_from DESC LIMIT 1) END`, cur, d, DefaultCurrency)
+}
+
+// convertedPriceSQL — цена строки prices в валюте target (плейсхолдер вида "$1::text"),
+// округлённая до масштаба колонки цены.
+func convertedPriceSQL(target string, scale int32) string {
+	return fmt.Sprintf(`CASE WHEN currency = %[1]s THEN price
+  ELSE ROUND(price * (%[2]s) / (%[3]s), %[4]d) END`,
+		target, rateSQL("currency", "create_date"), rateSQL(target, "create_date"), scale)
+}
+
+type RatesResult struct {
+	TotalCount int64 `json:"total_count"`
+	Upserted   int64 `json:"upserted"`
+}
+
+var rateValueRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// ImportRates грузит csv с колонками currency, valid_from, rate.
+// Файл курсов небольшой, поэтому любая ошибка отклоняет его целиком.
+func (s *Service) ImportRates(ctx context.Context, r io.Reader) (RatesResult, error) {
+	var res RatesResult
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return res, importErrorf(CodeBadCSV, "rates: read csv header: %v", err)
+	}
+	idx := map[string]int{}
+	for i, h := range header {
+		idx[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, col := range []string{"currency", "valid_from", "rate"} {
+		if _, ok := idx[col]; !ok {
+			return res, importErrorf(CodeBadCSV, "rates: missing required column %q", col)
+		}
+	}
+
+	batch := &pgx.Batch{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, importErrorf(CodeBadCSV, "rates: %v", err)
+		}
+		line, _ := cr.FieldPos(0)
+		get := func(col string) string {
+			if i := idx[col]; i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+
+		cur, err := ParseCurrency(get("currency"))
+		if err != nil {
+			return res, importErrorf(CodeBadCSV, "rates: line %d: %v", line, err)
+		}
+		if cur == DefaultCurrency {
+			return res, importErrorf(CodeBadCSV, "rates: line %d: %s is the base currency, its rate is always 1", line, cur)
+		}
+		d, err := time.Parse(DefaultDateLayout, get("valid_from"))
+		if err != nil {
+			return res, importErrorf(CodeBadCSV, "rates: line %d: valid_from must be YYYY-MM-DD", line)
+		}
+		rate := get("rate")
+		if !rateValueRe.MatchString(rate) || strings.Trim(rate, "0.") == "" {
+			return res, importErrorf(CodeBadCSV, "rates: line %d: rate must be a positive number with '.' as decimal separator", line)
+		}
+
+		batch.Queue(`
+INSERT INTO currency_rates(currency, valid_from, rate)
+VALUES ($1, $2, $3::numeric)
+ON CONFLICT (currency, valid_from) DO UPDATE SET rate = EXCLUDED.rate`, cur, d, rate)
+		res.TotalCount++
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return res, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	br := tx.SendBatch(ctx, batch)
+	for i := 0; i < batch.Len(); i++ {
+		tag, err := br.Exec()
+		if err != nil {
+			_ = br.Close()
+			return res, fmt.Errorf("upsert rate: %w", err)
+		}
+		res.Upserted += tag.RowsAffected()
+	}
+	if err := br.Close(); err != nil {
+		return res, fmt.Errorf("upsert rates: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return res, fmt.Errorf("commit: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,152 @@
+package prices
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultDateLayout = "2006-01-02"
+
+	// особые форматы, которые не выражаются layout'ом time.Parse
+	DateRFC3339 = "rfc3339"
+	DateExcel   = "excel"
+
+	// date_format=auto: перебираем autoDateLayouts и выбираем один на файл
+	DateAuto = "auto"
+)
+
+var autoDateLayouts = []string{
+	DefaultDateLayout,
+	"02.01.2006",
+	"02/01/2006",
+	"01/02/2006",
+	"02-01-2006",
+	"2006/01/02",
+	"2006-01-02 15:04:05",
+	DateRFC3339,
+	DateExcel,
+}
+
+// Сколько строк можно придержать, пока формат даты ещё не выбран.
+const maxPendingDateRows = 10000
+
+// ParseDateLayouts разбирает значения date_format. Допустимы auto,
+// rfc3339, excel, layout Go ("02.01.2006") или шаблон вида DD.MM.YYYY.
+// Пусто — только DefaultDateLayout, как раньше.
+func ParseDateLayouts(values []string) ([]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	var out []string
+	seen := map[string]bool{}
+	add := func(l string) {
+		if !seen[l] {
+			seen[l] = true
+			out = append(out, l)
+		}
+	}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		switch strings.ToLower(v) {
+		case DateAuto:
+			for _, l := range autoDateLayouts {
+				add(l)
+			}
+			continue
+		case "iso":
+			add(DefaultDateLayout)
+			continue
+		case DateRFC3339, DateExcel:
+			add(strings.ToLower(v))
+			continue
+		}
+		l := strings.NewReplacer("YYYY", "2006", "MM", "01", "DD", "02").Replace(v)
+		if !validDateLayout(l) {
+			return nil, fmt.Errorf("invalid date_format %q: use auto, iso, rfc3339, excel, a Go layout or a pattern like DD.MM.YYYY", v)
+		}
+		add(l)
+	}
+	return out, nil
+}
+
+// validDateLayout: layout должен однозначно задавать год, месяц и день.
+func validDateLayout(l string) bool {
+	ref := time.Date(2031, 12, 29, 0, 0, 0, 0, time.UTC)
+	t, err := time.Parse(l, ref.Format(l))
+	return err == nil && t.Equal(ref)
+}
+
+func parseDateAs(layout, s string) (time.Time, bool) {
+	switch layout {
+	case DateExcel:
+		f, err := strconv.ParseFloat(s, 64)
+		// до 9999-12-31 включительно
+		if err != nil || f < 1 || f > 2958465 {
+			return time.Time{}, false
+		}
+		return excelSerialToDate(f, false), true
+	case DateRFC3339:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return time.Time{}, false
+		}
+		// дата в часовом поясе самой метки, а не в UTC
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), true
+	default:
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), true
+	}
+}
+
+// dateResolver выбирает один формат даты на весь файл. Каждая строка
+// оставляет только те кандидаты, которыми она разбирается, поэтому все
+// оставшиеся кандидаты подходят ко всем уже принятым строкам.
+type dateResolver struct {
+	candidates []string
+}
+
+func newDateResolver(layouts []string) *dateResolver {
+	if len(layouts) == 0 {
+		layouts = []string{DefaultDateLayout}
+	}
+	return &dateResolver{candidates: layouts}
+}
+
+// observe сужает кандидатов по значению; false — не подходит ни один.
+func (d *dateResolver) observe(s string) bool {
+	var left []string
+	for _, l := range d.candidates {
+		if _, ok := parseDateAs(l, s); ok {
+			left = append(left, l)
+		}
+	}
+	if len(left) == 0 {
+		return false
+	}
+	d.candidates = left
+	return true
+}
+
+// date возвращает дату, если все оставшиеся кандидаты с ней согласны.
+func (d *dateResolver) date(s string) (time.Time, bool) {
+	var res time.Time
+	for i, l := range d.candidates {
+		t, ok := parseDateAs(l, s)
+		if !ok || (i > 0 && !t.Equal(res)) {
+			return time.Time{}, false
+		}
+		res = t
+	}
+	return res, true
+}
+
+func (d *dateResolver) ambiguous(entry string, sample string) error {
+	return importErrorf(CodeAmbiguousDate, "%s: cannot tell date format of create_date (e.g. %q): candidates %s; pass date_format explicitly",
+		entryLabel(entry), sample, strings.Join(d.candidates, ", "))
+}
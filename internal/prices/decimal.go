@@ -0,0 +1,197 @@
+package prices
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Decimal — точное десятичное число coef·10^-scale. Цены и суммы считаем
+// в нём, без float64: сумма большого прайса в float теряет копейки.
+// Нулевое значение — 0.
+type Decimal struct {
+	coef  *big.Int
+	scale int32
+}
+
+// Правила округления цены до масштаба колонки.
+const (
+	// лишние знаки — ошибка, строка отклоняется
+	RoundReject   = "reject"
+	RoundHalfUp   = "half_up"
+	RoundHalfEven = "half_even"
+	// отбросить лишние знаки
+	RoundDown = "down"
+)
+
+// Колонка цены: 10 знаков до точки, как у исходной NUMERIC(12,2).
+const (
+	PriceIntDigits = 10
+	MaxPriceScale  = 6
+)
+
+// PriceColumn — тип prices.price: NUMERIC(Precision, Scale).
+type PriceColumn struct {
+	Precision int32
+	Scale     int32
+}
+
+func NewPriceColumn(scale int) PriceColumn {
+	return PriceColumn{Precision: PriceIntDigits + int32(scale), Scale: int32(scale)}
+}
+
+func ParseRounding(s string) (string, error) {
+	switch m := strings.ToLower(strings.TrimSpace(s)); m {
+	case "":
+		return RoundReject, nil
+	case RoundReject, RoundHalfUp, RoundHalfEven, RoundDown:
+		return m, nil
+	default:
+		return "", fmt.Errorf("query param 'rounding' must be one of: reject, half_up, half_even, down")
+	}
+}
+
+var errBadDecimal = errors.New("bad decimal")
+
+// ParseDecimal разбирает "-123.4500": знак, цифры, необязательная дробная часть.
+// Масштаб — число цифр после точки, как написано.
+func ParseDecimal(s string) (Decimal, error) {
+	digits := strings.TrimPrefix(s, "-")
+	intPart, frac, hasFrac := strings.Cut(digits, ".")
+	if intPart == "" || (hasFrac && frac == "") || !allDigits(intPart) || !allDigits(frac) {
+		return Decimal{}, errBadDecimal
+	}
+	coef, ok := new(big.Int).SetString(intPart+frac, 10)
+	if !ok {
+		return Decimal{}, errBadDecimal
+	}
+	if len(digits) != len(s) {
+		coef.Neg(coef)
+	}
+	return Decimal{coef: coef, scale: int32(len(frac))}, nil
+}
+
+func allDigits(s string) bool {
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (d Decimal) int() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+func (d Decimal) Sign() int { return d.int().Sign() }
+
+// IntDigits — цифр до точки; у 0.5 — ноль.
+func (d Decimal) IntDigits() int {
+	q := new(big.Int).Quo(new(big.Int).Abs(d.int()), pow10(d.scale))
+	if q.Sign() == 0 {
+		return 0
+	}
+	return len(q.String())
+}
+
+// rescaled — коэффициент при большем или равном масштабе, без потерь.
+func (d Decimal) rescaled(scale int32) *big.Int {
+	return new(big.Int).Mul(d.int(), pow10(scale-d.scale))
+}
+
+// Round приводит число к масштабу scale. ok=false — при RoundReject
+// пришлось бы отбросить ненулевые цифры.
+func (d Decimal) Round(scale int32, mode string) (Decimal, bool) {
+	if scale >= d.scale {
+		return Decimal{coef: d.rescaled(scale), scale: scale}, true
+	}
+
+	div := pow10(d.scale - scale)
+	q, r := new(big.Int).QuoRem(d.int(), div, new(big.Int))
+	if r.Sign() == 0 {
+		return Decimal{coef: q, scale: scale}, true
+	}
+
+	// QuoRem отбрасывает дробь к нулю; away — на единицу дальше от нуля
+	away := false
+	switch mode {
+	case RoundReject:
+		return Decimal{}, false
+	case RoundDown:
+	case RoundHalfUp, RoundHalfEven:
+		twice := new(big.Int).Lsh(new(big.Int).Abs(r), 1)
+		switch twice.Cmp(div) {
+		case 1:
+			away = true
+		case 0:
+			away = mode == RoundHalfUp || q.Bit(0) == 1
+		}
+	default:
+		return Decimal{}, false
+	}
+	if away {
+		q.Add(q, big.NewInt(int64(d.int().Sign())))
+	}
+	return Decimal{coef: q, scale: scale}, true
+}
+
+// String — ровно scale знаков после точки: "1299.90".
+func (d Decimal) String() string {
+	abs := new(big.Int).Abs(d.int()).String()
+	sign := ""
+	if d.int().Sign() < 0 {
+		sign = "-"
+	}
+	if d.scale <= 0 {
+		return sign + abs
+	}
+	if pad := int(d.scale) + 1 - len(abs); pad > 0 {
+		abs = strings.Repeat("0", pad) + abs
+	}
+	cut := len(abs) - int(d.scale)
+	return sign + abs[:cut] + "." + abs[cut:]
+}
+
+func (d Decimal) Numeric() pgtype.Numeric {
+	return pgtype.Numeric{Int: new(big.Int).Set(d.int()), Exp: -d.scale, Valid: true}
+}
+
+// MarshalJSON — всегда число с точным текстом, например 1299.90, а не
+// то int, то float, как было с float64.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON принимает число или строку. Старые результаты импорта в
+// imports.result могли быть записаны из float64, в том числе с экспонентой.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	s := strings.Trim(string(b), `"`)
+	if v, err := ParseDecimal(s); err == nil {
+		*d = v
+		return nil
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return fmt.Errorf("invalid decimal %s", b)
+	}
+	v, err := ParseDecimal(strings.TrimRight(strings.TrimRight(r.FloatString(MaxPriceScale), "0"), "."))
+	if err != nil {
+		return fmt.Errorf("invalid decimal %s", b)
+	}
+	*d = v
+	return nil
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
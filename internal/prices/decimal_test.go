@@ -0,0 +1,107 @@
+package prices
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	col2 := NewPriceColumn(2)
+	col4 := NewPriceColumn(4)
+
+	tests := []struct {
+		in       string
+		col      PriceColumn
+		rounding string
+		want     string
+		err      error
+	}{
+		{"1299.9", col2, RoundReject, "1299.90", nil},
+		{".5", col2, RoundReject, "0.50", nil},
+		{"42", col2, RoundReject, "42.00", nil},
+		{"1.005", col2, RoundReject, "", errTooManyDecimals},
+		{"1.555", col2, "", "", errTooManyDecimals},
+		{"1.000", col2, RoundReject, "1.00", nil},
+
+		{"1.005", col2, RoundHalfUp, "1.01", nil},
+		{"1.004", col2, RoundHalfUp, "1.00", nil},
+		{"1.005", col2, RoundHalfEven, "1.00", nil},
+		{"1.015", col2, RoundHalfEven, "1.02", nil},
+		{"1.0151", col2, RoundHalfEven, "1.02", nil},
+		{"1.019", col2, RoundDown, "1.01", nil},
+		{"0.004", col2, RoundHalfUp, "", errNonPositivePrice},
+		{"0.009", col2, RoundDown, "", errNonPositivePrice},
+
+		{"1.23456", col4, RoundHalfUp, "1.2346", nil},
+		{"1.2345", col4, RoundReject, "1.2345", nil},
+
+		{"9999999999.99", col2, RoundReject, "9999999999.99", nil},
+		{"12345678901", col2, RoundReject, "", errPriceOverflow},
+		{"9999999999.995", col2, RoundHalfUp, "", errPriceOverflow},
+		{"9999999999.995", col2, RoundDown, "9999999999.99", nil},
+
+		{"0", col2, RoundReject, "", errNonPositivePrice},
+		{"-5", col2, RoundReject, "", errBadPrice},
+		{"1,5", col2, RoundReject, "", errDecimalSeparator},
+		{"1.2.3", col2, RoundReject, "", errBadPrice},
+		{"1.", col2, RoundReject, "", errBadPrice},
+		{"1e3", col2, RoundReject, "", errBadPrice},
+	}
+	for _, tt := range tests {
+		got, err := parsePrice(tt.in, tt.col, tt.rounding)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("parsePrice(%q, %s): err = %v, want %v", tt.in, tt.rounding, err, tt.err)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("parsePrice(%q, %s) = %s, want %s", tt.in, tt.rounding, got, tt.want)
+		}
+	}
+}
+
+func TestDecimalRoundNegative(t *testing.T) {
+	tests := []struct {
+		in, rounding, want string
+	}{
+		{"-1.005", RoundHalfUp, "-1.01"},
+		{"-1.005", RoundHalfEven, "-1.00"},
+		{"-1.019", RoundDown, "-1.01"},
+	}
+	for _, tt := range tests {
+		d, err := ParseDecimal(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := d.Round(2, tt.rounding)
+		if !ok || got.String() != tt.want {
+			t.Errorf("Round(%s, %s) = %s, %v, want %s", tt.in, tt.rounding, got, ok, tt.want)
+		}
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	big, err := ParseDecimal("123456789012345678901234567890.12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(ImportStats{TotalPrice: big})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back ImportStats
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.TotalPrice.String() != big.String() {
+		t.Errorf("round trip: got %s, want %s", back.TotalPrice, big)
+	}
+
+	// старые результаты, записанные из float64
+	for in, want := range map[string]string{"1234": "1234", "1234.5": "1234.5", "1e+21": "1000000000000000000000", `"12.30"`: "12.30"} {
+		var d Decimal
+		if err := json.Unmarshal([]byte(in), &d); err != nil || d.String() != want {
+			t.Errorf("unmarshal %s = %s, %v, want %s", in, d, err, want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package prices
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Форматы загрузки, которые умеем распознать по содержимому.
+const (
+	FormatZip    = "zip"
+	FormatXLSX   = "xlsx"
+	FormatTar    = "tar"
+	FormatTarGz  = "tar.gz"
+	FormatTarBz2 = "tar.bz2"
+	FormatGzip   = "gz"
+	FormatBzip2  = "bz2"
+	FormatCSV    = "csv"
+)
+
+const sniffLen = 1024
+
+// ParseImportType нормализует ?type=. Пустая строка — автоопределение.
+func ParseImportType(s string) (string, error) {
+	switch t := strings.ToLower(strings.TrimSpace(s)); t {
+	case "":
+		return "", nil
+	case FormatZip, FormatXLSX, FormatTar, FormatTarGz, FormatTarBz2, FormatGzip, FormatBzip2, FormatCSV:
+		return t, nil
+	case "tgz":
+		return FormatTarGz, nil
+	case "tbz2", "tbz":
+		return FormatTarBz2, nil
+	case "gzip":
+		return FormatGzip, nil
+	case "bzip2":
+		return FormatBzip2, nil
+	default:
+		return "", fmt.Errorf("query param 'type' must be one of: zip, tar, tar.gz, tar.bz2, csv, gz, bz2, xlsx")
+	}
+}
+
+// typeMatches: явный ?type=tar исторически принимал и сжатый tar.
+func typeMatches(requested, detected string) bool {
+	if requested == detected {
+		return true
+	}
+	return requested == FormatTar && (detected == FormatTarGz || detected == FormatTarBz2)
+}
+
+func detectFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open upload: %w", err)
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("read upload: %w", err)
+	}
+	head = head[:n]
+
+	switch {
+	case isZip(head):
+		// xlsx — тоже zip, отличаем по содержимому
+		st, err := f.Stat()
+		if err != nil {
+			return "", fmt.Errorf("stat upload: %w", err)
+		}
+		zr, err := zip.NewReader(f, st.Size())
+		if err != nil {
+			return "", importErrorf(CodeUnsupportedFormat, "broken zip archive: %v", err)
+		}
+		if isXLSX(zr) {
+			return FormatXLSX, nil
+		}
+		return FormatZip, nil
+	case isGzip(head), isBzip2(head):
+		// Сжатый поток: смотрим, что внутри — tar или голый csv
+		compressed, tarred := FormatGzip, FormatTarGz
+		if isBzip2(head) {
+			compressed, tarred = FormatBzip2, FormatTarBz2
+		}
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return "", fmt.Errorf("seek upload: %w", err)
+		}
+		dr, closeFn, err := decompressReader(f, compressed)
+		if err != nil {
+			return "", importErrorf(CodeUnsupportedFormat, "broken %s stream: %v", compressed, err)
+		}
+		defer closeFn()
+
+		inner := make([]byte, sniffLen)
+		n, err := io.ReadFull(dr, inner)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return "", importErrorf(CodeUnsupportedFormat, "broken %s stream: %v", compressed, err)
+		}
+		inner = inner[:n]
+		if isTar(inner) {
+			return tarred, nil
+		}
+		if isText(inner) {
+			return compressed, nil
+		}
+	case isTar(head):
+		return FormatTar, nil
+	case isText(head):
+		return FormatCSV, nil
+	}
+	return "", importErrorf(CodeUnsupportedFormat, "unsupported upload format: expected zip, tar, tar.gz, tar.bz2, gzip, bzip2, csv or xlsx")
+}
+
+// decompressReader снимает gzip/bzip2 в зависимости от формата,
+// для несжатых форматов возвращает r как есть.
+func decompressReader(r io.Reader, format string) (io.Reader, func(), error) {
+	switch format {
+	case FormatGzip, FormatTarGz:
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gzip reader: %w", err)
+		}
+		return gzr, func() { _ = gzr.Close() }, nil
+	case FormatBzip2, FormatTarBz2:
+		return bzip2.NewReader(r), func() {}, nil
+	default:
+		return r, func() {}, nil
+	}
+}
+
+func isZip(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("PK\x03\x04")) || bytes.HasPrefix(b, []byte("PK\x05\x06"))
+}
+
+func isGzip(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b
+}
+
+func isBzip2(b []byte) bool {
+	return len(b) >= 4 && b[0] == 'B' && b[1] == 'Z' && b[2] == 'h' && b[3] >= '1' && b[3] <= '9'
+}
+
+// isTar проверяет контрольную сумму заголовка: так ловятся и ustar, и старый v7 без magic.
+func isTar(b []byte) bool {
+	if len(b) < 512 {
+		return false
+	}
+	hdr := b[:512]
+
+	chk := strings.TrimRight(strings.TrimSpace(string(hdr[148:156])), "\x00")
+	var want int64
+	if _, err := fmt.Sscanf(chk, "%o", &want); err != nil {
+		return false
+	}
+
+	var sum int64
+	for i, c := range hdr {
+		if i >= 148 && i < 156 {
+			c = ' '
+		}
+		sum += int64(c)
+	}
+	return sum == want
+}
+
+// isText — грубая эвристика для csv. UTF-16 узнаём по BOM или нулям,
+// остальное — без NUL-байтов и почти без управляющих символов: однобайтовые
+// кодировки вроде windows-1251 на валидность не проверить.
+func isText(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	if enc, _ := sniffBOM(b); enc == EncodingUTF16LE || enc == EncodingUTF16BE {
+		return true
+	}
+	if sniffUTF16(b) != "" {
+		return true
+	}
+	if bytes.IndexByte(b, 0) >= 0 {
+		return false
+	}
+	ctrl := 0
+	for _, c := range b {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+			ctrl++
+		}
+	}
+	return ctrl*100 <= len(b)
+}
@@ -0,0 +1,135 @@
+package prices
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Downloader скачивает архив по URL для импорта. Ходить можно только на
+// хосты из allow-list, иначе сервер превращается в открытый прокси.
+type Downloader struct {
+	client   *http.Client
+	allowed  []string
+	maxBytes int64
+}
+
+func NewDownloader(allowedHosts []string, maxUploadMB int64) *Downloader {
+	d := &Downloader{allowed: allowedHosts, maxBytes: maxUploadMB * 1024 * 1024}
+	d.client = &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			// редирект тоже должен вести на разрешённый хост
+			return d.checkURL(req.URL)
+		},
+	}
+	return d
+}
+
+// Download сохраняет ответ во временный файл. expectedSHA256 (hex, можно с
+// префиксом "sha256:") проверяется, если задан.
+func (d *Downloader) Download(ctx context.Context, rawURL string, headers map[string]string, expectedSHA256 string) (string, func(), error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil, importErrorf(CodeURLNotAllowed, "invalid url: %v", err)
+	}
+	if err := d.checkURL(u); err != nil {
+		return "", nil, err
+	}
+
+	want := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(expectedSHA256), "sha256:"))
+	if want != "" {
+		if b, err := hex.DecodeString(want); err != nil || len(b) != sha256.Size {
+			return "", nil, importErrorf(CodeChecksumMismatch, "expected checksum must be a hex sha256")
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", nil, importErrorf(CodeURLNotAllowed, "invalid url: %v", err)
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, "Host") {
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		var ie *ImportError
+		if errors.As(err, &ie) {
+			return "", nil, ie
+		}
+		return "", nil, importErrorf(CodeDownloadFailed, "download: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, importErrorf(CodeDownloadFailed, "download: source responded %s", resp.Status)
+	}
+	if resp.ContentLength > d.maxBytes {
+		return "", nil, importErrorf(CodeDownloadTooLarge, "download: source is %d bytes, limit is %d", resp.ContentLength, d.maxBytes)
+	}
+
+	tmp, err := os.CreateTemp(os.TempDir(), "download-*.bin")
+	if err != nil {
+		return "", nil, fmt.Errorf("tempfile: %w", err)
+	}
+	cleanup := func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(resp.Body, d.maxBytes+1))
+	if err != nil {
+		cleanup()
+		return "", nil, importErrorf(CodeDownloadFailed, "download: %v", err)
+	}
+	if n > d.maxBytes {
+		cleanup()
+		return "", nil, importErrorf(CodeDownloadTooLarge, "download: source exceeds limit of %d bytes", d.maxBytes)
+	}
+	if n == 0 {
+		cleanup()
+		return "", nil, importErrorf(CodeDownloadFailed, "download: empty body")
+	}
+
+	if got := hex.EncodeToString(h.Sum(nil)); want != "" && got != want {
+		cleanup()
+		return "", nil, importErrorf(CodeChecksumMismatch, "checksum mismatch: expected %s, got %s", want, got)
+	}
+
+	_ = tmp.Sync()
+	_ = tmp.Close()
+	return filepath.Clean(tmp.Name()), cleanup, nil
+}
+
+func (d *Downloader) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return importErrorf(CodeURLNotAllowed, "only http and https urls are supported")
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, a := range d.allowed {
+		a = strings.ToLower(a)
+		if host == a {
+			return nil
+		}
+		// *.example.com разрешает поддомены, но не сам example.com
+		if strings.HasPrefix(a, "*.") && strings.HasSuffix(host, a[1:]) {
+			return nil
+		}
+	}
+	return importErrorf(CodeURLNotAllowed, "host %q is not in the import allow-list", host)
+}
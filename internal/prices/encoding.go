@@ -0,0 +1,133 @@
+package prices
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1251 = "windows-1251"
+)
+
+// ParseEncoding проверяет параметр encoding и возвращает каноническое
+// имя по WHATWG ("cp1251" -> "windows-1251"). Пусто или auto — определять самим.
+func ParseEncoding(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "auto" {
+		return "", nil
+	}
+	e, err := htmlindex.Get(s)
+	if err != nil {
+		return "", fmt.Errorf("unsupported encoding %q", s)
+	}
+	name, err := htmlindex.Name(e)
+	if err != nil {
+		return "", fmt.Errorf("unsupported encoding %q", s)
+	}
+	return name, nil
+}
+
+// decodeText перекодирует поток в UTF-8. enc пусто — BOM, затем эвристика;
+// возвращает имя кодировки, которая в итоге применена.
+func decodeText(r io.Reader, enc string) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, sniffLen*4)
+	head, err := br.Peek(sniffLen * 4)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, "", err
+	}
+
+	bomEnc, bomLen := sniffBOM(head)
+	name := enc
+	if name == "" {
+		name = bomEnc
+	}
+	if name == "" {
+		name = guessEncoding(head)
+	}
+	if bomLen > 0 && name == bomEnc {
+		if _, err := br.Discard(bomLen); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// невалидные байты UTF-8 не чиним, их отклонит проверка строки
+	if name == EncodingUTF8 {
+		return br, name, nil
+	}
+	e, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("encoding %q: %w", name, err)
+	}
+	return transform.NewReader(br, e.NewDecoder()), name, nil
+}
+
+func sniffBOM(b []byte) (string, int) {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}):
+		return EncodingUTF8, 3
+	case bytes.HasPrefix(b, []byte{0xFF, 0xFE}):
+		return EncodingUTF16LE, 2
+	case bytes.HasPrefix(b, []byte{0xFE, 0xFF}):
+		return EncodingUTF16BE, 2
+	}
+	return "", 0
+}
+
+// sniffUTF16 узнаёт UTF-16 без BOM по нулевым байтам: у латиницы и цифр
+// старший байт каждой пары нулевой.
+func sniffUTF16(b []byte) string {
+	pairs := len(b) / 2
+	if pairs < 2 {
+		return ""
+	}
+	var even, odd int
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i] == 0 {
+			even++
+		}
+		if b[i+1] == 0 {
+			odd++
+		}
+	}
+	switch {
+	case odd*10 >= pairs*4 && even*20 < pairs:
+		return EncodingUTF16LE
+	case even*10 >= pairs*4 && odd*20 < pairs:
+		return EncodingUTF16BE
+	}
+	return ""
+}
+
+// guessEncoding: UTF-16 по нулям, валидный UTF-8 как есть, иначе
+// считаем, что это windows-1251 — так сохраняет csv русский Excel.
+func guessEncoding(b []byte) string {
+	if enc := sniffUTF16(b); enc != "" {
+		return enc
+	}
+	if validUTF8Prefix(b) {
+		return EncodingUTF8
+	}
+	return EncodingWindows1251
+}
+
+// validUTF8Prefix: последний символ мог обрезаться на границе буфера.
+func validUTF8Prefix(b []byte) bool {
+	for i := 0; i < utf8.UTFMax && len(b) > 0; i++ {
+		if utf8.Valid(b) {
+			return true
+		}
+		b = b[:len(b)-1]
+	}
+	return len(b) == 0
+}
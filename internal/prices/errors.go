@@ -0,0 +1,46 @@
+package prices
+
+import "fmt"
+
+// Коды ошибок, которые вызвали входные данные или внешний источник, а не
+// сам сервер. Хендлеры отдают их клиенту с кодом и своим HTTP-статусом.
+const (
+	CodeBadCSV        = "bad_csv"
+	CodeBadJSON       = "bad_json"
+	CodeBadXLSX       = "bad_xlsx"
+	CodeNoCSV         = "no_csv_found"
+	CodeEntryNotFound = "entry_not_found"
+
+	CodeDuplicates    = "duplicates_found"
+	CodeAmbiguousDate = "ambiguous_date"
+	CodeNoRate        = "no_rate"
+
+	CodeUnknownMapping = "unknown_mapping"
+
+	CodeURLNotAllowed    = "url_not_allowed"
+	CodeDownloadFailed   = "download_failed"
+	CodeDownloadTooLarge = "download_too_large"
+	CodeChecksumMismatch = "checksum_mismatch"
+
+	CodeDecompressedTooLarge = "decompressed_too_large"
+	CodeCompressionRatio     = "compression_ratio_exceeded"
+	CodeTooManyEntries       = "too_many_entries"
+	CodeNestingTooDeep       = "nesting_too_deep"
+	CodeUnsafeEntryPath      = "unsafe_entry_path"
+
+	CodeUnsupportedFormat = "unsupported_format"
+	CodeTypeMismatch      = "type_mismatch"
+)
+
+type ImportError struct {
+	Code string
+	Msg  string
+}
+
+func (e *ImportError) Error() string {
+	return e.Msg
+}
+
+func importErrorf(code, format string, args ...any) error {
+	return &ImportError{Code: code, Msg: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,57 @@
+package prices
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+)
+
+// Выгрузку можно загрузить обратно: id из data.csv снова становится
+// external_id, а внутренний prices.id (row_id) в строки не попадает.
+func TestExportReimportKeepsExternalIDs(t *testing.T) {
+	ext := "SKU-42"
+	rows := []exportRow{
+		{ID: 7, ExternalID: &ext, Name: "Чайник", Category: "Кухня", Price: "1299.90", CreateDate: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Currency: "RUB", Source: "acme"},
+		{ID: 8, Name: "Кружка", Category: "Кухня", Price: "199.00", CreateDate: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), Currency: "RUB"},
+	}
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	if err := cw.Write(exportHeader); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		if err := cw.Write(r.record()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cw.Flush()
+
+	recs, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := headerIndex(recs[0], "data.csv", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := newRowParser(ImportOptions{}, NewPriceColumn(2))
+
+	for i, rec := range recs[1:] {
+		got, rej := rp.parse(rec, idx, false)
+		if rej != nil {
+			t.Fatalf("row %d rejected: %+v", i+1, *rej)
+		}
+		want := ""
+		if rows[i].ExternalID != nil {
+			want = *rows[i].ExternalID
+		}
+		if got.ExternalID != want {
+			t.Errorf("row %d: external_id = %q, want %q", i+1, got.ExternalID, want)
+		}
+		if got.Name != rows[i].Name || got.Price.String() != rows[i].Price {
+			t.Errorf("row %d: got %s %s, want %s %s", i+1, got.Name, got.Price, rows[i].Name, rows[i].Price)
+		}
+	}
+}
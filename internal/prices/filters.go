@@ -12,6 +12,12 @@ type ExportFilters struct {
 	End   *time.Time
 	Min   *int64
 	Max   *int64
+	// пересчитать цены в эту валюту по курсу на create_date; min/max — тоже в ней
+	Currency string
+	// nil — любой источник
+	Source *string
+	// id поставщика; несколько — любой из них
+	ExternalIDs []string
 }
 
 func ParseExportFilters(q url.Values) (ExportFilters, error) {
@@ -53,5 +59,27 @@ func ParseExportFilters(q url.Values) (ExportFilters, error) {
 		return f, fmt.Errorf("min must be <= max")
 	}
 
+	if v := q.Get("currency"); v != "" {
+		c, err := ParseCurrency(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid currency (expected 3-letter ISO 4217 code)")
+		}
+		f.Currency = c
+	}
+
+	if _, ok := q["source"]; ok {
+		s, err := ParseSource(q.Get("source"))
+		if err != nil {
+			return f, fmt.Errorf("invalid source")
+		}
+		f.Source = &s
+	}
+	for _, v := range q["external_id"] {
+		if v == "" || len(v) > maxExternalIDLen {
+			return f, fmt.Errorf("invalid external_id (expected 1-%d characters)", maxExternalIDLen)
+		}
+		f.ExternalIDs = append(f.ExternalIDs, v)
+	}
+
 	return f, nil
 }
@@ -0,0 +1,137 @@
+package prices
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Порядок полей в записи, которую собираем из json-объекта для parseRow.
+var jsonColIndex = map[string]int{"id": 0, "name": 1, "category": 2, "price": 3, "create_date": 4, "currency": 5}
+
+// ImportJSON грузит тело application/json (массив объектов) или
+// application/x-ndjson (объект на строку). Оба читаются потоком.
+func (s *Service) ImportJSON(ctx context.Context, r io.Reader, ndjson bool, opts ImportOptions) (ImportResult, error) {
+	return s.runImport(ctx, opts, func(tx pgx.Tx, res *ImportResult) error {
+		var next func() ([]string, int64, error)
+		if ndjson {
+			next = ndjsonRows(r, opts.Price)
+		} else {
+			var err error
+			next, err = jsonArrayRows(r, opts.Price)
+			if err != nil {
+				return err
+			}
+		}
+		return s.importRows(ctx, tx, "", jsonColIndex, next, opts, res)
+	})
+}
+
+// jsonArrayRows: номер строки в отказах — порядковый номер элемента массива.
+func jsonArrayRows(r io.Reader, price PriceDialect) (func() ([]string, int64, error), error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, jsonStreamError(err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return nil, importErrorf(CodeBadJSON, "json body must be an array of objects")
+	}
+
+	var n int64
+	return func() ([]string, int64, error) {
+		if !dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return nil, 0, jsonStreamError(err)
+			}
+			return nil, 0, io.EOF
+		}
+		n++
+
+		var obj map[string]any
+		if err := dec.Decode(&obj); err != nil {
+			// синтаксическая ошибка ломает весь поток, тип — только этот элемент
+			var te *json.UnmarshalTypeError
+			if errors.As(err, &te) {
+				return nil, n, &rowReadError{Err: err}
+			}
+			return nil, n, jsonStreamError(err)
+		}
+		return jsonRecord(obj, price), n, nil
+	}, nil
+}
+
+// jsonStreamError: битый json — ошибка клиента, остальное (обрыв тела,
+// превышение лимита) отдаём как есть.
+func jsonStreamError(err error) error {
+	var se *json.SyntaxError
+	if errors.As(err, &se) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return importErrorf(CodeBadJSON, "read json: %v", err)
+	}
+	return fmt.Errorf("read json: %w", err)
+}
+
+func ndjsonRows(r io.Reader, price PriceDialect) func() ([]string, int64, error) {
+	br := bufio.NewReader(r)
+	var line int64
+	return func() ([]string, int64, error) {
+		for {
+			b, err := br.ReadBytes('\n')
+			if err != nil && err != io.EOF {
+				return nil, 0, fmt.Errorf("read ndjson: %w", err)
+			}
+			if len(b) == 0 && err == io.EOF {
+				return nil, 0, io.EOF
+			}
+			line++
+
+			b = bytes.TrimSpace(b)
+			if len(b) == 0 {
+				continue
+			}
+
+			dec := json.NewDecoder(bytes.NewReader(b))
+			dec.UseNumber()
+			var obj map[string]any
+			if derr := dec.Decode(&obj); derr != nil {
+				return nil, line, &rowReadError{Err: derr, Raw: string(b)}
+			}
+			return jsonRecord(obj, price), line, nil
+		}
+	}
+}
+
+// Числа json всегда с точкой; цену переводим в запись диалекта,
+// чтобы строки и числа разбирались одинаково.
+func jsonRecord(obj map[string]any, price PriceDialect) []string {
+	rec := make([]string, len(jsonColIndex))
+	for k, v := range obj {
+		i, ok := jsonColIndex[strings.ToLower(k)]
+		if !ok {
+			continue
+		}
+		switch v := v.(type) {
+		case nil:
+		case string:
+			rec[i] = v
+		case json.Number:
+			rec[i] = v.String()
+			if i == jsonColIndex["price"] {
+				rec[i] = price.localize(rec[i])
+			}
+		default:
+			b, _ := json.Marshal(v)
+			rec[i] = string(b)
+		}
+	}
+	return rec
+}
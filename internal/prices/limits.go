@@ -0,0 +1,112 @@
+package prices
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"strings"
+)
+
+// ArchiveLimits ограничивают то, во что может распаковаться загрузка:
+// MaxUploadMB режет только сжатое тело. Нулевое поле — без ограничения.
+type ArchiveLimits struct {
+	// сумма распакованных байт всех прочитанных файлов
+	MaxDecompressedBytes int64
+	// распаковано / размер загрузки
+	MaxRatio float64
+	// записей в архиве, включая каталоги и пропущенные файлы
+	MaxEntries int
+	// вложенность каталогов в путях записей; архивы внутри архивов не распаковываются вообще
+	MaxDepth int
+}
+
+// Степень сжатия проверяем только после первого мегабайта: маленький
+// однообразный csv легко жмётся в сотни раз.
+const ratioCheckAfter = 1 << 20
+
+// archiveGuard считает распакованные байты одного импорта.
+type archiveGuard struct {
+	limits     ArchiveLimits
+	compressed int64
+	total      int64
+	entries    int
+}
+
+func newArchiveGuard(limits ArchiveLimits, uploadPath string) *archiveGuard {
+	g := &archiveGuard{limits: limits}
+	if fi, err := os.Stat(uploadPath); err == nil {
+		g.compressed = fi.Size()
+	}
+	return g
+}
+
+func (g *archiveGuard) add(n int) error {
+	g.total += int64(n)
+	if g.limits.MaxDecompressedBytes > 0 && g.total > g.limits.MaxDecompressedBytes {
+		return importErrorf(CodeDecompressedTooLarge, "archive expands to more than %d bytes", g.limits.MaxDecompressedBytes)
+	}
+	if g.limits.MaxRatio > 0 && g.compressed > 0 && g.total > ratioCheckAfter &&
+		float64(g.total)/float64(g.compressed) > g.limits.MaxRatio {
+		return importErrorf(CodeCompressionRatio, "archive compression ratio exceeds %g", g.limits.MaxRatio)
+	}
+	return nil
+}
+
+// entry проверяет очередную запись архива: число записей, путь и вложенность.
+func (g *archiveGuard) entry(rawName string) error {
+	g.entries++
+	if g.limits.MaxEntries > 0 && g.entries > g.limits.MaxEntries {
+		return importErrorf(CodeTooManyEntries, "archive has more than %d entries", g.limits.MaxEntries)
+	}
+
+	name := strings.ReplaceAll(rawName, `\`, "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return importErrorf(CodeUnsafeEntryPath, "archive entry %q has an absolute path", rawName)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return importErrorf(CodeUnsafeEntryPath, "archive entry %q escapes the archive root", rawName)
+		}
+	}
+
+	if g.limits.MaxDepth > 0 && strings.Count(strings.Trim(cleanEntryName(name), "/"), "/") > g.limits.MaxDepth {
+		return importErrorf(CodeNestingTooDeep, "archive entry %q is nested deeper than %d directories", rawName, g.limits.MaxDepth)
+	}
+	return nil
+}
+
+// zipEntries проверяет каталог zip до распаковки: число записей, пути и
+// заявленные размеры. Заявленным размерам не верим, их же проверяет reader.
+func (g *archiveGuard) zipEntries(zr *zip.Reader) error {
+	if g.limits.MaxEntries > 0 && len(zr.File) > g.limits.MaxEntries {
+		return importErrorf(CodeTooManyEntries, "archive has more than %d entries", g.limits.MaxEntries)
+	}
+	var declared uint64
+	for _, f := range zr.File {
+		if err := g.entry(f.Name); err != nil {
+			return err
+		}
+		declared += f.UncompressedSize64
+	}
+	if g.limits.MaxDecompressedBytes > 0 && declared > uint64(g.limits.MaxDecompressedBytes) {
+		return importErrorf(CodeDecompressedTooLarge, "archive expands to more than %d bytes", g.limits.MaxDecompressedBytes)
+	}
+	return nil
+}
+
+func (g *archiveGuard) reader(r io.Reader) io.Reader {
+	return &guardedReader{r: r, g: g}
+}
+
+type guardedReader struct {
+	r io.Reader
+	g *archiveGuard
+}
+
+func (gr *guardedReader) Read(p []byte) (int, error) {
+	n, err := gr.r.Read(p)
+	if lerr := gr.g.add(n); lerr != nil {
+		return n, lerr
+	}
+	return n, err
+}
@@ -0,0 +1,219 @@
+package prices
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ColumnMapping — именованный профиль, который сопоставляет колонки файла
+// полям импорта: по заголовкам (Aliases) или по номерам колонок (Positions)
+// для файлов без заголовка.
+type ColumnMapping struct {
+	Name string `json:"name"`
+	// поле -> допустимые заголовки; имя самого поля подходит всегда
+	Aliases map[string][]string `json:"aliases,omitempty"`
+	// поле -> номер колонки с 1; если задано, заголовок не разбирается
+	Positions map[string]int `json:"positions,omitempty"`
+	// с Positions: первая строка — заголовок, её пропускаем
+	SkipHeader bool `json:"skip_header,omitempty"`
+	// встроенный профиль, через API не меняется
+	Builtin bool `json:"builtin,omitempty"`
+}
+
+var (
+	ErrMappingNotFound = errors.New("column mapping not found")
+	ErrBuiltinMapping  = errors.New("builtin column mapping cannot be changed")
+	ErrInvalidMapping  = errors.New("invalid column mapping")
+)
+
+var (
+	requiredFields = []string{"name", "category", "price", "create_date"}
+	rowFields      = []string{"id", "name", "category", "price", "create_date", "currency"}
+	mappingFields  = map[string]bool{"id": true, "name": true, "category": true, "price": true, "create_date": true, "currency": true}
+	mappingNameRe  = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+)
+
+var builtinMappings = map[string]ColumnMapping{
+	"ru": {
+		Name: "ru",
+		Aliases: map[string][]string{
+			"id":          {"ид", "код", "артикул"},
+			"name":        {"наименование", "название", "товар"},
+			"category":    {"категория", "группа"},
+			"price":       {"цена", "стоимость"},
+			"create_date": {"дата", "дата создания"},
+			"currency":    {"валюта"},
+		},
+		Builtin: true,
+	},
+}
+
+func normalizeHeader(h string) string {
+	return strings.Join(strings.Fields(strings.ToLower(h)), " ")
+}
+
+func (m *ColumnMapping) headerless() bool {
+	return m != nil && len(m.Positions) > 0
+}
+
+// Validate проверяет профиль перед сохранением.
+func (m ColumnMapping) Validate() error {
+	if !mappingNameRe.MatchString(m.Name) {
+		return errors.New("mapping name must match [a-z0-9_-]{1,64}")
+	}
+	if len(m.Aliases) > 0 && len(m.Positions) > 0 {
+		return errors.New("use either aliases or positions, not both")
+	}
+	if m.SkipHeader && len(m.Positions) == 0 {
+		return errors.New("skip_header is only valid with positions")
+	}
+
+	owner := map[string]string{}
+	for field, aliases := range m.Aliases {
+		if !mappingFields[field] {
+			return fmt.Errorf("unknown field %q", field)
+		}
+		for _, a := range aliases {
+			a = normalizeHeader(a)
+			if a == "" {
+				return fmt.Errorf("empty alias for %q", field)
+			}
+			if f, ok := owner[a]; ok && f != field {
+				return fmt.Errorf("alias %q is used for both %q and %q", a, f, field)
+			}
+			owner[a] = field
+		}
+	}
+
+	if len(m.Positions) > 0 {
+		used := map[int]string{}
+		for field, pos := range m.Positions {
+			if !mappingFields[field] {
+				return fmt.Errorf("unknown field %q", field)
+			}
+			if pos < 1 {
+				return fmt.Errorf("position of %q must be >= 1", field)
+			}
+			if f, ok := used[pos]; ok {
+				return fmt.Errorf("column %d is used for both %q and %q", pos, f, field)
+			}
+			used[pos] = field
+		}
+		for _, f := range requiredFields {
+			if _, ok := m.Positions[f]; !ok {
+				return fmt.Errorf("position of required field %q is missing", f)
+			}
+		}
+	}
+	return nil
+}
+
+// positionIndex — индекс колонок для файла без заголовка.
+func (m *ColumnMapping) positionIndex() map[string]int {
+	idx := make(map[string]int, len(m.Positions))
+	for f, p := range m.Positions {
+		idx[f] = p - 1
+	}
+	return idx
+}
+
+func (s *Service) ListMappings(ctx context.Context) ([]ColumnMapping, error) {
+	out := []ColumnMapping{}
+	for _, m := range builtinMappings {
+		out = append(out, m)
+	}
+
+	rows, err := s.pool.Query(ctx, `SELECT mapping FROM column_mappings ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list mappings: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m ColumnMapping
+		if err := rows.Scan(&m); err != nil {
+			return nil, fmt.Errorf("scan mapping: %w", err)
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list mappings: %w", err)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (s *Service) GetMapping(ctx context.Context, name string) (ColumnMapping, error) {
+	if m, ok := builtinMappings[name]; ok {
+		return m, nil
+	}
+	var m ColumnMapping
+	err := s.pool.QueryRow(ctx, `SELECT mapping FROM column_mappings WHERE name = $1`, name).Scan(&m)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ColumnMapping{}, ErrMappingNotFound
+	}
+	if err != nil {
+		return ColumnMapping{}, fmt.Errorf("get mapping: %w", err)
+	}
+	return m, nil
+}
+
+// PutMapping создаёт или заменяет профиль; created — профиля раньше не было.
+func (s *Service) PutMapping(ctx context.Context, m ColumnMapping) (created bool, err error) {
+	if _, ok := builtinMappings[m.Name]; ok {
+		return false, ErrBuiltinMapping
+	}
+	m.Builtin = false
+	if err := m.Validate(); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidMapping, err)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return false, fmt.Errorf("encode mapping: %w", err)
+	}
+
+	err = s.pool.QueryRow(ctx, `
+INSERT INTO column_mappings(name, mapping) VALUES ($1, $2)
+ON CONFLICT (name) DO UPDATE SET mapping = EXCLUDED.mapping, updated_at = now()
+RETURNING xmax = 0`, m.Name, b).Scan(&created)
+	if err != nil {
+		return false, fmt.Errorf("put mapping: %w", err)
+	}
+	return created, nil
+}
+
+func (s *Service) DeleteMapping(ctx context.Context, name string) error {
+	if _, ok := builtinMappings[name]; ok {
+		return ErrBuiltinMapping
+	}
+	tag, err := s.pool.Exec(ctx, `DELETE FROM column_mappings WHERE name = $1`, name)
+	if err != nil {
+		return fmt.Errorf("delete mapping: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMappingNotFound
+	}
+	return nil
+}
+
+// resolveMapping загружает профиль, выбранный для импорта.
+func (s *Service) resolveMapping(ctx context.Context, name string) (*ColumnMapping, error) {
+	if name == "" {
+		return nil, nil
+	}
+	m, err := s.GetMapping(ctx, name)
+	if errors.Is(err, ErrMappingNotFound) {
+		return nil, importErrorf(CodeUnknownMapping, "column mapping %q not found", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -1,9 +1,129 @@
 package prices
 
+import "sync/atomic"
+
 type ImportResult struct {
-	TotalCount      int64 `json:"total_count"`
-	DuplicatesCount int64 `json:"duplicates_count"`
-	TotalItems      int64 `json:"total_items"`
-	TotalCategories int64 `json:"total_categories"`
-	TotalPrice      any   `json:"total_price"`
+	// запись в imports; 0 — импорт не записывался (dry run)
+	ImportID int64 `json:"import_id,omitempty"`
+
+	TotalCount      int64   `json:"total_count"`
+	DuplicatesCount int64   `json:"duplicates_count"`
+	TotalItems      int64   `json:"total_items"`
+	TotalCategories int64   `json:"total_categories"`
+	TotalPrice      Decimal `json:"total_price"`
+	UpdatedCount    int64   `json:"updated_count"`
+
+	// TotalsCurrency — валюта total_price, если её запросили; строки без
+	// курса на свою дату в сумму не входят и считаются в unconverted_count
+	TotalsCurrency   string `json:"totals_currency,omitempty"`
+	UnconvertedCount int64  `json:"unconverted_count,omitempty"`
+
+	// DryRun — импорт только проверен, Persisted=false: в базу ничего не записано
+	DryRun    bool `json:"dry_run"`
+	Persisted bool `json:"persisted"`
+
+	// Stats — только строки, вставленные этим импортом; Table — вся таблица
+	// на момент импорта, в той же транзакции. Поля total_* выше — из Table.
+	Stats ImportStats `json:"stats"`
+	Table ImportStats `json:"table"`
+
+	Files []FileResult `json:"files"`
+
+	RejectedCount       int64       `json:"rejected_count"`
+	Rejections          []Rejection `json:"rejections"`
+	RejectionsTruncated bool        `json:"rejections_truncated,omitempty"`
+}
+
+// FileResult — счётчики по одному csv внутри архива.
+// Имена полей не совпадают с полями ImportResult: ответ разбирают и grep'ом,
+// повтор ключа "total_count" там ломает проверки.
+type FileResult struct {
+	Entry      string `json:"entry"`
+	Rows       int64  `json:"rows"`
+	Duplicates int64  `json:"duplicates"`
+	Inserted   int64  `json:"inserted"`
+	Updated    int64  `json:"updated"`
+	Rejected   int64  `json:"rejected"`
+	// кодировка, в которой прочитан csv
+	Encoding string `json:"encoding,omitempty"`
+	// разделитель и кавычка csv; нет для xlsx и json
+	Dialect *CSVDialect `json:"dialect,omitempty"`
+}
+
+// ImportOptions сохраняется в json вместе с асинхронной задачей,
+// поэтому у runtime-полей тег "-".
+type ImportOptions struct {
+	Type string `json:"type,omitempty"`
+	// пути внутри архива; пусто — импортируем все .csv
+	Entries []string `json:"entries,omitempty"`
+	// лист xlsx; пусто — первый
+	Sheet string `json:"sheet,omitempty"`
+	// всё посчитать и откатить транзакцию
+	DryRun bool `json:"dry_run,omitempty"`
+	// skip (по умолчанию), fail или upsert
+	Mode string `json:"mode,omitempty"`
+	// ключ для upsert, по умолчанию DefaultUpsertKey
+	UpsertKey []string `json:"upsert_key,omitempty"`
+	// как записаны цены; нулевое значение — строгий формат
+	Price PriceDialect `json:"price"`
+	// что делать с лишними знаками после точки; пусто — RoundReject
+	Rounding string `json:"rounding,omitempty"`
+	// допустимые форматы create_date; пусто — только 2006-01-02
+	DateLayouts []string `json:"date_layouts,omitempty"`
+	// валюта строк без колонки currency; пусто — DefaultCurrency
+	Currency string `json:"currency,omitempty"`
+	// пересчитать total_price в эту валюту
+	TotalsCurrency string `json:"totals_currency,omitempty"`
+	// имя профиля ColumnMapping; пусто — заголовки как есть
+	Mapping string `json:"mapping,omitempty"`
+	// кодировка csv; пусто — BOM или эвристика
+	Encoding string `json:"encoding,omitempty"`
+	// разделитель csv; пусто — определить по файлу
+	Delimiter string `json:"delimiter,omitempty"`
+	// кавычка csv; пусто — '"'
+	Quote string `json:"quote,omitempty"`
+	// источник (поставщик), в пределах которого уникален external_id
+	Source string `json:"source,omitempty"`
+
+	// если задан, сюда пишутся отклонённые строки в формате rejects.csv
+	Rejects *RejectsWriter `json:"-"`
+	// если задан, увеличивается на каждую прочитанную строку
+	Progress *atomic.Int64 `json:"-"`
+
+	// запись в imports, на которую ссылаются вставленные строки; 0 — без неё
+	ImportID int64 `json:"-"`
+
+	// профиль Mapping, загруженный в начале импорта
+	columns *ColumnMapping
+	// если задан: true — дата текущей строки уже в DefaultDateLayout
+	// (числовая ячейка xlsx), её не сверяем с DateLayouts
+	isoDate func() bool
+}
+
+type RejectReason string
+
+const (
+	RejectMalformedRow     RejectReason = "malformed_row"
+	RejectEmptyValue       RejectReason = "empty_value"
+	RejectInvalidPrice     RejectReason = "invalid_price"
+	RejectNonPositivePrice RejectReason = "non_positive_price"
+	RejectTooManyDecimals  RejectReason = "too_many_decimals"
+	RejectInvalidDate      RejectReason = "invalid_date"
+	RejectInvalidCurrency  RejectReason = "invalid_currency"
+	RejectInvalidEncoding  RejectReason = "invalid_encoding"
+	// upsert по external_id, а id в строке нет
+	RejectMissingExternalID RejectReason = "missing_external_id"
+	RejectInvalidExternalID RejectReason = "invalid_external_id"
+	// цена не помещается в NUMERIC колонки prices.price
+	RejectPriceOverflow RejectReason = "price_overflow"
+)
+
+type Rejection struct {
+	File   string       `json:"file,omitempty"`
+	Line   int64        `json:"line"`
+	Column string       `json:"column,omitempty"`
+	Value  string       `json:"value"`
+	Reason RejectReason `json:"reason"`
+	// текст ошибки разбора для malformed_row
+	Error string `json:"error,omitempty"`
 }
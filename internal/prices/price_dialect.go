@@ -0,0 +1,188 @@
+package prices
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PriceDialect описывает, как записаны цены в файле. Нулевое значение —
+// строгий формат: только '.' как десятичный разделитель, без групп и валют.
+type PriceDialect struct {
+	// "." или ","
+	Decimal string `json:"decimal,omitempty"`
+	// разделитель тысяч: "", ThousandsSpace (любой пробел, в т.ч. неразрывный), ",", ".", "'"
+	Thousands string `json:"thousands,omitempty"`
+	// убирать символ или код валюты в начале/конце: "₽", "$", "USD", "руб."
+	StripCurrency bool `json:"strip_currency,omitempty"`
+}
+
+const ThousandsSpace = "space"
+
+// PriceProfiles — именованные диалекты для query-параметра price_profile.
+var PriceProfiles = map[string]PriceDialect{
+	"strict": {},
+	"ru":     {Decimal: ",", Thousands: ThousandsSpace, StripCurrency: true},
+	"de":     {Decimal: ",", Thousands: ".", StripCurrency: true},
+	"en":     {Decimal: ".", Thousands: ",", StripCurrency: true},
+	"ch":     {Decimal: ".", Thousands: "'", StripCurrency: true},
+}
+
+// ParsePriceDialect собирает диалект из профиля и отдельных параметров;
+// отдельные параметры перекрывают значения профиля.
+func ParsePriceDialect(profile, decimal, thousands, stripCurrency string) (PriceDialect, error) {
+	var d PriceDialect
+	if p := strings.ToLower(strings.TrimSpace(profile)); p != "" {
+		var ok bool
+		d, ok = PriceProfiles[p]
+		if !ok {
+			return d, fmt.Errorf("unknown price_profile %q (allowed: strict, ru, de, en, ch)", profile)
+		}
+	}
+
+	switch decimal {
+	case "":
+	case ".", ",":
+		d.Decimal = decimal
+	default:
+		return d, fmt.Errorf("query param 'decimal_sep' must be '.' or ','")
+	}
+
+	switch t := strings.ToLower(thousands); t {
+	case "":
+	case "none":
+		d.Thousands = ""
+	case ThousandsSpace, "nbsp", " ":
+		d.Thousands = ThousandsSpace
+	case ",", ".", "'":
+		d.Thousands = t
+	default:
+		return d, fmt.Errorf("query param 'thousands_sep' must be one of: none, space, nbsp, ',', '.', \"'\"")
+	}
+
+	switch strings.ToLower(stripCurrency) {
+	case "":
+	case "1", "true":
+		d.StripCurrency = true
+	case "0", "false":
+		d.StripCurrency = false
+	default:
+		return d, fmt.Errorf("query param 'strip_currency' must be a boolean")
+	}
+
+	if d.Thousands != "" && d.Thousands == d.decimal() {
+		return d, fmt.Errorf("decimal and thousands separators must differ")
+	}
+	return d, nil
+}
+
+func (d PriceDialect) decimal() string {
+	if d.Decimal == "" {
+		return "."
+	}
+	return d.Decimal
+}
+
+func (d PriceDialect) strict() bool {
+	return d.decimal() == "." && d.Thousands == "" && !d.StripCurrency
+}
+
+// localize переводит машинное число (json number, числовая ячейка xlsx)
+// в запись диалекта, чтобы normalize разобрал его обратно без потерь.
+func (d PriceDialect) localize(s string) string {
+	if d.decimal() == "." {
+		return s
+	}
+	return strings.Replace(s, ".", d.decimal(), 1)
+}
+
+var (
+	currencyPrefix = regexp.MustCompile(`^(\p{Sc}|\p{L}+\.?)[\s\p{Zs}]*`)
+	currencySuffix = regexp.MustCompile(`[\s\p{Zs}]*(\p{Sc}|\p{L}+\.?)$`)
+)
+
+// Сокращения валют, которые не символ и не код ISO 4217; сравниваем без учёта регистра.
+var currencyAbbrevs = map[string]bool{
+	"руб": true, "руб.": true, "р": true, "р.": true,
+	"fr": true, "fr.": true, "sfr": true, "sfr.": true,
+}
+
+// isCurrencyToken — символ валюты, код ISO 4217 заглавными или известное
+// сокращение. Прочие буквы не трогаем: "12abc" должна отклоняться.
+func isCurrencyToken(s string) bool {
+	if r, size := utf8.DecodeRuneInString(s); size == len(s) && unicode.Is(unicode.Sc, r) {
+		return true
+	}
+	if currencyCodeRe.MatchString(s) {
+		_, err := ParseCurrency(s)
+		return err == nil
+	}
+	return currencyAbbrevs[strings.ToLower(s)]
+}
+
+func stripCurrency(s string) string {
+	if m := currencyPrefix.FindStringSubmatch(s); m != nil && isCurrencyToken(m[1]) {
+		s = s[len(m[0]):]
+	}
+	if m := currencySuffix.FindStringSubmatch(s); m != nil && isCurrencyToken(m[1]) {
+		s = s[:len(s)-len(m[0])]
+	}
+	return s
+}
+
+// normalize приводит цену к строгому виду "1299.99" для parsePrice.
+// В строгом диалекте строка не меняется.
+func (d PriceDialect) normalize(s string) (string, error) {
+	if d.strict() {
+		return s, nil
+	}
+	s = strings.TrimFunc(s, unicode.IsSpace)
+	if d.StripCurrency {
+		s = stripCurrency(s)
+	}
+
+	intPart, frac, hasFrac := strings.Cut(s, d.decimal())
+	if hasFrac && strings.Contains(frac, d.decimal()) {
+		return "", errBadPrice
+	}
+
+	if d.Thousands != "" {
+		var groups []string
+		if d.Thousands == ThousandsSpace {
+			groups = strings.FieldsFunc(intPart, unicode.IsSpace)
+			// FieldsFunc схлопывает соседние пробелы, "1  299" считаем ошибкой
+			if strings.Join(groups, " ") != strings.Map(spaceToASCII, intPart) {
+				return "", errBadPrice
+			}
+		} else {
+			groups = strings.Split(intPart, d.Thousands)
+		}
+		if len(groups) > 1 {
+			for i, g := range groups {
+				if (i == 0 && (len(g) < 1 || len(g) > 3)) || (i > 0 && len(g) != 3) {
+					return "", errBadPrice
+				}
+			}
+		}
+		intPart = strings.Join(groups, "")
+	}
+
+	for _, ch := range intPart {
+		if ch < '0' || ch > '9' {
+			return "", errBadPrice
+		}
+	}
+	if !hasFrac {
+		return intPart, nil
+	}
+	return intPart + "." + frac, nil
+}
+
+func spaceToASCII(r rune) rune {
+	if unicode.IsSpace(r) {
+		return ' '
+	}
+	return r
+}
@@ -0,0 +1,68 @@
+package prices
+
+import "testing"
+
+func TestParsePriceStripCurrency(t *testing.T) {
+	ru := PriceProfiles["ru"]
+	en := PriceProfiles["en"]
+	ch := PriceProfiles["ch"]
+
+	accepted := []struct {
+		in   string
+		d    PriceDialect
+		want string
+	}{
+		{"1 299,99 ₽", ru, "1299.99"},
+		{"1 299,99 руб.", ru, "1299.99"},
+		{"1 299,99 Руб", ru, "1299.99"},
+		{"1299,99р.", ru, "1299.99"},
+		{"1299,99 RUB", ru, "1299.99"},
+		{"RUB 1299,99", ru, "1299.99"},
+		{"$1,299.99", en, "1299.99"},
+		{"1,299.99 USD", en, "1299.99"},
+		{"€ 12.50", en, "12.50"},
+		{"EUR12.50", en, "12.50"},
+		{"CHF 1'299.90", ch, "1299.90"},
+		{"1'299.90 Fr.", ch, "1299.90"},
+		{"42", ru, "42.00"},
+	}
+	// как в rowParser.parse: normalize, затем parsePrice
+	parse := func(d PriceDialect, s string) (string, error) {
+		norm, err := d.normalize(s)
+		if err != nil {
+			return "", err
+		}
+		price, err := parsePrice(norm, NewPriceColumn(2), RoundReject)
+		if err != nil {
+			return "", err
+		}
+		return price.String(), nil
+	}
+
+	for _, tt := range accepted {
+		got, err := parse(tt.d, tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parse(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+
+	rejected := []struct {
+		in string
+		d  PriceDialect
+	}{
+		{"12abc", ru},
+		{"abc12", ru},
+		{"1299,99x", ru},
+		{"x1299,99", ru},
+		{"12 rub", ru},
+		{"12 руб руб", ru},
+		{"12 Rubles", en},
+		{"USDX 12", en},
+		{"$$12", en},
+	}
+	for _, tt := range rejected {
+		if got, err := parse(tt.d, tt.in); err == nil {
+			t.Errorf("parse(%q) = %q, want error", tt.in, got)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package prices
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// в json-ответ попадают только первые отказы, полный список — в rejects.csv
+const maxReportedRejections = 1000
+
+var rejectsHeader = []string{"id", "name", "category", "price", "create_date", "currency", "reject_file", "reject_line", "reject_column", "reject_reason"}
+
+// RejectsWriter пишет отклонённые строки так, чтобы файл можно было
+// поправить и загрузить обратно: лишние колонки importCSV игнорирует.
+type RejectsWriter struct {
+	cw          *csv.Writer
+	wroteHeader bool
+}
+
+func NewRejectsWriter(w io.Writer) *RejectsWriter {
+	return &RejectsWriter{cw: csv.NewWriter(w)}
+}
+
+func (rw *RejectsWriter) write(rec []string, idx map[string]int, rej Rejection) error {
+	if !rw.wroteHeader {
+		if err := rw.cw.Write(rejectsHeader); err != nil {
+			return err
+		}
+		rw.wroteHeader = true
+	}
+
+	get := func(col string) string {
+		i, ok := idx[col]
+		if !ok || i < 0 || i >= len(rec) {
+			return ""
+		}
+		return rec[i]
+	}
+
+	return rw.cw.Write([]string{
+		get("id"),
+		get("name"),
+		get("category"),
+		get("price"),
+		get("create_date"),
+		get("currency"),
+		rej.File,
+		strconv.FormatInt(rej.Line, 10),
+		rej.Column,
+		string(rej.Reason),
+	})
+}
+
+func (rw *RejectsWriter) Flush() error {
+	if !rw.wroteHeader {
+		if err := rw.cw.Write(rejectsHeader); err != nil {
+			return err
+		}
+		rw.wroteHeader = true
+	}
+	rw.cw.Flush()
+	return rw.cw.Error()
+}
+
+func (res *ImportResult) addRejection(rej Rejection) {
+	res.RejectedCount++
+	if len(res.Rejections) >= maxReportedRejections {
+		res.RejectionsTruncated = true
+		return
+	}
+	res.Rejections = append(res.Rejections, rej)
+}
+
+// ResultZip упаковывает результат импорта и rejects.csv в один архив.
+func ResultZip(res ImportResult, rejectsCSV []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	fw, err := zw.Create("result.json")
+	if err != nil {
+		return nil, fmt.Errorf("zip create result.json: %w", err)
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(res); err != nil {
+		return nil, fmt.Errorf("encode result: %w", err)
+	}
+
+	fw, err = zw.Create("rejects.csv")
+	if err != nil {
+		return nil, fmt.Errorf("zip create rejects.csv: %w", err)
+	}
+	if _, err := fw.Write(rejectsCSV); err != nil {
+		return nil, fmt.Errorf("zip write rejects.csv: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("zip close: %w", err)
+	}
+	return buf.Bytes(), nil
+}
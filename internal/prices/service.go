@@ -1,340 +1,599 @@
 package prices
 
 import (
-	"archive/tar"
 	"archive/zip"
 	"bufio"
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"math"
-	"os"
-	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Service struct {
 	pool   *pgxpool.Pool
 	logger *slog.Logger
+	limits ArchiveLimits
+	column PriceColumn
 }
 
-func NewService(pool *pgxpool.Pool, logger *slog.Logger) *Service {
-	return &Service{pool: pool, logger: logger}
+func NewService(pool *pgxpool.Pool, logger *slog.Logger, limits ArchiveLimits, column PriceColumn) *Service {
+	return &Service{pool: pool, logger: logger, limits: limits, column: column}
 }
 
 type rowParsed struct {
-	// id из csv игнорируем при вставке
+	// id из csv, сохраняется как external_id; пусто — нет
+	ExternalID string
 	Name       string
 	Category   string
-	PriceCents int64
-	PriceStr   string
-	CreateDate time.Time
+	Price      Decimal
+	Currency   string
+	// исходная строка даты, пока формат даты файла не выбран
+	dateRaw string
+	// дата уже разобрана (числовая ячейка xlsx), формат файла не нужен
+	date *time.Time
+	// строка в файле, сохраняется в prices.source_line
+	line int64
 }
 
-func (s *Service) ImportArchive(ctx context.Context, tempFilePath string, archType string) (ImportResult, error) {
-	switch archType {
-	case "zip":
-		return s.importZip(ctx, tempFilePath)
-	case "tar":
-		return s.importTar(ctx, tempFilePath)
-	default:
-		return ImportResult{}, fmt.Errorf("unsupported archive type %q", archType)
-	}
+func (s *Service) ImportArchive(ctx context.Context, tempFilePath string, opts ImportOptions) (ImportResult, error) {
+	// Формат определяем по содержимому, ?type= только сверяем с ним
+	format, err := detectFormat(tempFilePath)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	if opts.Type != "" && !typeMatches(opts.Type, format) {
+		return ImportResult{}, importErrorf(CodeTypeMismatch, "type %q does not match uploaded content (detected %s)", opts.Type, format)
+	}
+	if opts.columns, err = s.resolveMapping(ctx, opts.Mapping); err != nil {
+		return ImportResult{}, err
+	}
+
+	guard := newArchiveGuard(s.limits, tempFilePath)
+
+	// Все csv из архива грузим в одной транзакции: либо всё, либо ничего
+	return s.runImport(ctx, opts, func(tx pgx.Tx, res *ImportResult) error {
+		switch format {
+		case FormatZip:
+			return s.importZip(ctx, tx, tempFilePath, guard, opts, res)
+		case FormatXLSX:
+			return s.importXLSX(ctx, tx, tempFilePath, guard, opts, res)
+		case FormatTar, FormatTarGz, FormatTarBz2:
+			return s.importTar(ctx, tx, tempFilePath, format, guard, opts, res)
+		case FormatGzip, FormatBzip2, FormatCSV:
+			return s.importPlain(ctx, tx, tempFilePath, format, guard, opts, res)
+		default:
+			return fmt.Errorf("unsupported archive type %q", format)
+		}
+	})
 }
 
-func (s *Service) importZip(ctx context.Context, tempFilePath string) (ImportResult, error) {
-	zr, err := zip.OpenReader(tempFilePath)
+// runImport открывает транзакцию со staging-таблицей, вызывает fn и
+// до коммита снимает статистику импорта и таблицы. При opts.DryRun
+// транзакция откатывается.
+func (s *Service) runImport(ctx context.Context, opts ImportOptions, fn func(tx pgx.Tx, res *ImportResult) error) (ImportResult, error) {
+	res := ImportResult{Files: []FileResult{}, Rejections: []Rejection{}}
+
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return ImportResult{}, fmt.Errorf("open zip: %w", err)
+		return ImportResult{}, fmt.Errorf("begin tx: %w", err)
 	}
-	defer zr.Close()
+	defer func() { _ = tx.Rollback(ctx) }()
 
-	var csvFile *zip.File
-	for _, f := range zr.File {
-		if f.FileInfo().IsDir() {
-			continue
-		}
-		if strings.HasSuffix(strings.ToLower(f.Name), ".csv") {
-			csvFile = f
-			break
-		}
+	if _, err := tx.Exec(ctx, createStagingSQL); err != nil {
+		return ImportResult{}, fmt.Errorf("create staging: %w", err)
 	}
-	if csvFile == nil {
-		return ImportResult{}, errors.New("zip: no .csv file found")
+	if _, err := tx.Exec(ctx, createImportedSQL); err != nil {
+		return ImportResult{}, fmt.Errorf("create imported ids: %w", err)
 	}
 
-	rc, err := csvFile.Open()
-	if err != nil {
-		return ImportResult{}, fmt.Errorf("zip open csv: %w", err)
+	if err := fn(tx, &res); err != nil {
+		return ImportResult{}, err
+	}
+
+	if err := fillStats(ctx, tx, opts.TotalsCurrency, s.column, &res); err != nil {
+		return ImportResult{}, err
+	}
+
+	// dry run: откатываем в defer
+	if opts.DryRun {
+		res.DryRun = true
+		return res, nil
 	}
-	defer rc.Close()
 
-	return s.importCSV(ctx, rc)
+	if err := tx.Commit(ctx); err != nil {
+		return ImportResult{}, fmt.Errorf("commit: %w", err)
+	}
+	res.Persisted = true
+	return res, nil
 }
 
-func (s *Service) importTar(ctx context.Context, tempFilePath string) (ImportResult, error) {
-	f, err := os.Open(tempFilePath)
+func (s *Service) importCSV(ctx context.Context, tx pgx.Tx, entry string, r io.Reader, opts ImportOptions, res *ImportResult) error {
+	r, encoding, err := decodeText(r, opts.Encoding)
 	if err != nil {
-		return ImportResult{}, fmt.Errorf("open tar file: %w", err)
+		return fmt.Errorf("%s: read: %w", entryLabel(entry), err)
 	}
-	defer f.Close()
 
-	br := bufio.NewReader(f)
-	peek, _ := br.Peek(2)
+	quote, err := ParseQuote(opts.Quote)
+	if err != nil {
+		return err
+	}
+	dialect := CSVDialect{Delimiter: opts.Delimiter, Quote: quote}
+	br := bufio.NewReaderSize(r, sniffDialectSize)
+	if dialect.Delimiter == "" {
+		sample, err := br.Peek(sniffDialectSize)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+			return fmt.Errorf("%s: read: %w", entryLabel(entry), err)
+		}
+		dialect.Delimiter = sniffDelimiter(sample, quote[0], len(sample) == sniffDialectSize)
+		dialect.Detected = true
+	}
 
-	var tr *tar.Reader
-	if len(peek) == 2 && peek[0] == 0x1f && peek[1] == 0x8b {
-		gzr, err := gzip.NewReader(br)
-		if err != nil {
-			return ImportResult{}, fmt.Errorf("gzip reader: %w", err)
+	var src io.Reader = br
+	swapped := quote != `"`
+	if swapped {
+		src = &swapReader{r: br, a: quote[0], b: '"'}
+	}
+
+	cr := csv.NewReader(src)
+	cr.Comma = rune(dialect.Delimiter[0])
+	cr.FieldsPerRecord = -1
+	// с табом TrimLeadingSpace съел бы пустые поля
+	cr.TrimLeadingSpace = dialect.Delimiter != "\t"
+	read := func() ([]string, error) {
+		rec, err := cr.Read()
+		if swapped {
+			swapFields(rec, quote[0], '"')
 		}
-		defer gzr.Close()
-		tr = tar.NewReader(gzr)
-	} else {
-		tr = tar.NewReader(br)
+		return rec, err
 	}
 
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
+	var colIndex map[string]int
+	if opts.columns.headerless() {
+		colIndex = opts.columns.positionIndex()
+		if opts.columns.SkipHeader {
+			if _, err := read(); err != nil && err != io.EOF {
+				return importErrorf(CodeBadCSV, "%s: read csv header: %v", entry, err)
+			}
 		}
+	} else {
+		header, err := read()
 		if err != nil {
-			return ImportResult{}, fmt.Errorf("tar read: %w", err)
-		}
-		if hdr.FileInfo().IsDir() {
-			continue
+			return importErrorf(CodeBadCSV, "%s: read csv header: %v", entry, err)
 		}
-		if strings.HasSuffix(strings.ToLower(hdr.Name), ".csv") {
-			return s.importCSV(ctx, tr)
+		colIndex, err = headerIndex(header, entry, opts.columns)
+		if err != nil {
+			return err
 		}
 	}
-	return ImportResult{}, errors.New("tar: no .csv file found")
-}
 
-func (s *Service) importCSV(ctx context.Context, r io.Reader) (ImportResult, error) {
-	cr := csv.NewReader(r)
-	cr.FieldsPerRecord = -1
-	cr.TrimLeadingSpace = true
+	next := func() ([]string, int64, error) {
+		rec, err := read()
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		if err != nil {
+			// битая строка — отказ по строке, ошибка чтения потока — конец импорта
+			var pe *csv.ParseError
+			if !errors.As(err, &pe) {
+				return nil, 0, err
+			}
+			return rec, int64(pe.StartLine), &rowReadError{Err: err, Raw: strings.Join(rec, string(cr.Comma))}
+		}
+		line, _ := cr.FieldPos(0)
+		return rec, int64(line), nil
+	}
 
-	header, err := cr.Read()
-	if err != nil {
-		return ImportResult{}, fmt.Errorf("read csv header: %w", err)
+	if err := s.importRows(ctx, tx, entry, colIndex, next, opts, res); err != nil {
+		return err
 	}
+	fr := &res.Files[len(res.Files)-1]
+	fr.Encoding = encoding
+	fr.Dialect = &dialect
+	return nil
+}
 
+// headerIndex сопоставляет заголовки полям; m — профиль с синонимами, может быть nil.
+func headerIndex(header []string, entry string, m *ColumnMapping) (map[string]int, error) {
 	colIndex := map[string]int{}
 	for i, h := range header {
-		colIndex[strings.ToLower(strings.TrimSpace(h))] = i
+		colIndex[normalizeHeader(h)] = i
+	}
+
+	if m != nil {
+		alias := map[string]string{}
+		for f, as := range m.Aliases {
+			for _, a := range as {
+				alias[normalizeHeader(a)] = f
+			}
+		}
+		mapped := map[string]bool{}
+		for i, h := range header {
+			f, ok := alias[normalizeHeader(h)]
+			if !ok {
+				continue
+			}
+			if j, dup := colIndex[f]; dup && j != i {
+				return nil, importErrorf(CodeBadCSV, "%s: columns %d and %d both map to %q", entry, j+1, i+1, f)
+			}
+			if mapped[f] {
+				continue
+			}
+			mapped[f] = true
+			colIndex[f] = i
+		}
 	}
 
-	required := []string{"name", "category", "price", "create_date"}
-	for _, col := range required {
+	for _, col := range requiredFields {
 		if _, ok := colIndex[col]; !ok {
-			return ImportResult{}, fmt.Errorf("csv missing required column %q", col)
+			if m != nil {
+				return nil, importErrorf(CodeBadCSV, "%s: missing required column %q (mapping %q)", entry, col, m.Name)
+			}
+			return nil, importErrorf(CodeBadCSV, "%s: missing required column %q", entry, col)
 		}
 	}
+	return colIndex, nil
+}
 
-	// Читаем весь файлл и потом начинаем вставку
-	var totalCount int64
-	rowsToInsert := make([]rowParsed, 0, 1024)
+// rowReadError — строку не удалось прочитать, но остальной файл читается дальше.
+type rowReadError struct {
+	Err error
+	// то, что удалось прочитать из строки; пусто — неизвестно
+	Raw string
+}
 
-	for {
-		rec, err := cr.Read()
-		if err == io.EOF {
-			break
+func (e *rowReadError) Error() string {
+	return e.Err.Error()
+}
+
+// importRows общая часть для всех форматов: валидирует записи, которые отдаёт
+// next, и сливает их в prices. next возвращает io.EOF в конце данных.
+func (s *Service) importRows(ctx context.Context, tx pgx.Tx, entry string, colIndex map[string]int, next func() ([]string, int64, error), opts ImportOptions, res *ImportResult) error {
+	fr := FileResult{Entry: entry}
+	countRow := func() {
+		fr.Rows++
+		if opts.Progress != nil {
+			opts.Progress.Add(1)
 		}
-		if err != nil {
-			totalCount++
-			s.logger.Warn("csv read error, skipping line", "err", err)
-			continue
+	}
+	reject := func(rec []string, rej Rejection) error {
+		rej.File = entry
+		fr.Rejected++
+		res.addRejection(rej)
+		if opts.Rejects == nil {
+			return nil
 		}
+		return opts.Rejects.write(rec, colIndex, rej)
+	}
+
+	rp := newRowParser(opts, s.column)
+
+	// Строки льются в staging через COPY прямо по мере чтения,
+	// весь файл в памяти не держим
+	var seq int64
+	var srcErr error
+	// строки, дата которых ещё допускает несколько форматов; держим их,
+	// чтобы не менять порядок seq
+	var pending []rowParsed
+	eof := false
+	src := pgx.CopyFromFunc(func() (vals []any, err error) {
+		// pgx теряет тип ошибки источника, сохраняем её сами
+		defer func() { srcErr = err }()
+		for {
+			if len(pending) > 0 {
+				var dt time.Time
+				var ok bool
+				if pending[0].date != nil {
+					dt, ok = *pending[0].date, true
+				} else {
+					dt, ok = rp.dates.date(pending[0].dateRaw)
+				}
+				if ok {
+					row := pending[0]
+					if len(pending) == 1 {
+						pending = pending[:0]
+					} else {
+						pending = pending[1:]
+					}
+					seq++
+					return []any{seq, row.Name, row.Category, row.Price.Numeric(), dt, row.Currency, row.line, row.ExternalID}, nil
+				}
+				if eof || len(pending) >= maxPendingDateRows {
+					return nil, rp.dates.ambiguous(entry, pending[0].dateRaw)
+				}
+			}
+			if eof {
+				return nil, nil
+			}
+
+			rec, line, err := next()
+			if err == io.EOF {
+				eof = true
+				continue
+			}
+			var rre *rowReadError
+			if errors.As(err, &rre) {
+				countRow()
+				s.logger.Warn("read error, skipping line", "entry", entry, "line", line, "err", rre.Err)
+				if err := reject(rec, Rejection{Line: line, Value: rre.Raw, Error: rre.Error(), Reason: RejectMalformedRow}); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
 
-		totalCount++
+			countRow()
 
-		row, ok := parseRow(rec, colIndex)
-		if !ok {
-			continue
+			row, rej := rp.parse(rec, colIndex, opts.isoDate != nil && opts.isoDate())
+			if rej != nil {
+				rej.Line = line
+				if err := reject(rec, *rej); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			row.line = line
+			pending = append(pending, row)
 		}
+	})
 
-		rowsToInsert = append(rowsToInsert, row)
+	staged, err := tx.CopyFrom(ctx, pgx.Identifier{stagingTable}, stagingColumns, src)
+	if srcErr != nil {
+		return srcErr
 	}
-
-	// Вставка в транзакции дубли считаем через UNIQUE
-	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return ImportResult{}, fmt.Errorf("begin tx: %w", err)
+		return fmt.Errorf("%s: copy to staging: %w", entry, err)
 	}
-	defer func() { _ = tx.Rollback(ctx) }()
 
-	var duplicatesCount, inserted int64
+	mc, err := mergeStaging(ctx, tx, entry, opts)
+	if err != nil {
+		return fmt.Errorf("%s: merge staging: %w", entry, err)
+	}
+	if _, err := tx.Exec(ctx, truncateStagingSQL); err != nil {
+		return fmt.Errorf("%s: truncate staging: %w", entry, err)
+	}
 
-	const insertSQL = `
-INSERT INTO prices(name, category, price, create_date)
-VALUES ($1, $2, $3::numeric, $4)
-ON CONFLICT (name, category, price, create_date) DO NOTHING;
-`
+	fr.Inserted = mc.inserted
+	fr.Updated = mc.updated
+	fr.Duplicates = staged - mc.inserted - mc.updated
 
-	for _, row := range rowsToInsert {
-		tag, err := tx.Exec(ctx, insertSQL, row.Name, row.Category, row.PriceStr, row.CreateDate)
-		if err != nil {
-			return ImportResult{}, fmt.Errorf("insert: %w", err)
-		}
-		if tag.RowsAffected() == 0 {
-			duplicatesCount++
-			continue
-		}
-		inserted++
+	if opts.Mode == ModeFail && fr.Duplicates > 0 {
+		return importErrorf(CodeDuplicates, "%s: %d duplicate rows found, nothing imported (mode=fail)", entryLabel(entry), fr.Duplicates)
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return ImportResult{}, fmt.Errorf("commit: %w", err)
-	}
+	res.Files = append(res.Files, fr)
+	res.TotalCount += fr.Rows
+	res.DuplicatesCount += fr.Duplicates
+	res.TotalItems += fr.Inserted
+	res.UpdatedCount += fr.Updated
+	return nil
+}
 
-	var cats int64
-	if err := s.pool.QueryRow(ctx, `SELECT COUNT(DISTINCT category) FROM prices`).Scan(&cats); err != nil {
-		return ImportResult{}, fmt.Errorf("count categories: %w", err)
+func entryLabel(entry string) string {
+	if entry == "" {
+		return "upload"
 	}
+	return entry
+}
 
-	var sumTxt string
-	if err := s.pool.QueryRow(ctx, `SELECT COALESCE(SUM(price),0)::text FROM prices`).Scan(&sumTxt); err != nil {
-		return ImportResult{}, fmt.Errorf("sum price: %w", err)
-	}
-	totalPriceAny := parseNumericText(sumTxt)
+// rowParser держит настройки разбора значений на время одного файла.
+type rowParser struct {
+	price    PriceDialect
+	dates    *dateResolver
+	currency string
+	// без external_id строку не с чем сопоставить
+	requireExternalID bool
+	column            PriceColumn
+	rounding          string
+}
 
-	return ImportResult{
-		TotalCount:      totalCount,
-		DuplicatesCount: duplicatesCount,
-		TotalItems:      inserted,
-		TotalCategories: cats,
-		TotalPrice:      totalPriceAny,
-	}, nil
+func newRowParser(opts ImportOptions, column PriceColumn) *rowParser {
+	currency := opts.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return &rowParser{price: opts.Price, dates: newDateResolver(opts.DateLayouts), currency: currency, requireExternalID: keyedByExternalID(opts),
+		column: column, rounding: opts.Rounding}
 }
 
-func parseRow(rec []string, idx map[string]int) (rowParsed, bool) {
+// isoDate — дата строки уже в DefaultDateLayout независимо от формата файла.
+func (p *rowParser) parse(rec []string, idx map[string]int, isoDate bool) (rowParsed, *Rejection) {
 	get := func(col string) string {
-		i := idx[col]
-		if i < 0 || i >= len(rec) {
+		i, ok := idx[col]
+		if !ok || i < 0 || i >= len(rec) {
 			return ""
 		}
 		return strings.TrimSpace(rec[i])
 	}
 
+	// после перекодировки в UTF-8 битые байты возможны только в самом UTF-8
+	for _, col := range rowFields {
+		if v := get(col); !utf8.ValidString(v) {
+			return rowParsed{}, &Rejection{Column: col, Value: strings.ToValidUTF8(v, "\uFFFD"), Reason: RejectInvalidEncoding}
+		}
+	}
+
+	externalID := get("id")
 	name := get("name")
 	category := get("category")
 	priceStr := get("price")
 	dateStr := get("create_date")
 
-	if name == "" || category == "" || priceStr == "" || dateStr == "" {
-		return rowParsed{}, false
+	if externalID == "" && p.requireExternalID {
+		return rowParsed{}, &Rejection{Column: "id", Reason: RejectMissingExternalID}
+	}
+	if len(externalID) > maxExternalIDLen {
+		return rowParsed{}, &Rejection{Column: "id", Value: externalID, Reason: RejectInvalidExternalID}
 	}
 
-	cents, canon, err := parsePriceToCents(priceStr)
-	if err != nil || cents <= 0 {
-		return rowParsed{}, false
+	for _, f := range []struct{ col, val string }{
+		{"name", name},
+		{"category", category},
+		{"price", priceStr},
+		{"create_date", dateStr},
+	} {
+		if f.val == "" {
+			return rowParsed{}, &Rejection{Column: f.col, Reason: RejectEmptyValue}
+		}
 	}
 
-	dt, err := time.Parse("2006-01-02", dateStr)
+	normPrice, err := p.price.normalize(priceStr)
+	if err != nil {
+		return rowParsed{}, &Rejection{Column: "price", Value: priceStr, Reason: priceRejectReason(err)}
+	}
+	price, err := parsePrice(normPrice, p.column, p.rounding)
 	if err != nil {
-		return rowParsed{}, false
+		return rowParsed{}, &Rejection{Column: "price", Value: priceStr, Reason: priceRejectReason(err)}
 	}
 
-	return rowParsed{
+	currency := p.currency
+	if v := get("currency"); v != "" {
+		c, err := ParseCurrency(v)
+		if err != nil {
+			return rowParsed{}, &Rejection{Column: "currency", Value: v, Reason: RejectInvalidCurrency}
+		}
+		currency = c
+	}
+
+	row := rowParsed{
+		ExternalID: externalID,
 		Name:       name,
 		Category:   category,
-		PriceCents: cents,
-		PriceStr:   canon,
-		CreateDate: dt,
-	}, true
+		Price:      price,
+		Currency:   currency,
+		dateRaw:    dateStr,
+	}
+	if isoDate {
+		t, ok := parseDateAs(DefaultDateLayout, dateStr)
+		if !ok {
+			return rowParsed{}, &Rejection{Column: "create_date", Value: dateStr, Reason: RejectInvalidDate}
+		}
+		row.date = &t
+		return row, nil
+	}
+
+	// дату окончательно разбирает importRows, когда формат файла выбран
+	if !p.dates.observe(dateStr) {
+		return rowParsed{}, &Rejection{Column: "create_date", Value: dateStr, Reason: RejectInvalidDate}
+	}
+	return row, nil
 }
 
-func parsePriceToCents(s string) (int64, string, error) {
+var (
+	errBadPrice         = errors.New("bad price")
+	errTooManyDecimals  = errors.New("too many fractional digits")
+	errNonPositivePrice = errors.New("non-positive price")
+	errDecimalSeparator = errors.New("price must use '.' as decimal separator")
+	errPriceOverflow    = errors.New("price does not fit the price column")
+)
+
+func priceRejectReason(err error) RejectReason {
+	switch {
+	case errors.Is(err, errTooManyDecimals):
+		return RejectTooManyDecimals
+	case errors.Is(err, errNonPositivePrice):
+		return RejectNonPositivePrice
+	case errors.Is(err, errPriceOverflow):
+		return RejectPriceOverflow
+	default:
+		return RejectInvalidPrice
+	}
+}
+
+// parsePrice разбирает цену в строгом формате "1299.9" и приводит её к
+// масштабу колонки по правилу rounding.
+func parsePrice(s string, col PriceColumn, rounding string) (Decimal, error) {
 	s = strings.TrimSpace(s)
 	if s == "" {
-		return 0, "", errors.New("empty price")
+		return Decimal{}, errors.New("empty price")
 	}
 	if strings.Contains(s, ",") {
-		return 0, "", errors.New("price must use '.' as decimal separator")
+		return Decimal{}, errDecimalSeparator
 	}
 	if strings.HasPrefix(s, ".") {
 		s = "0" + s
 	}
+	// знак не принимаем: "-5" — не цена, а не отрицательная цена
+	if strings.HasPrefix(s, "-") {
+		return Decimal{}, errBadPrice
+	}
 
-	// Простая валидация
-	parts := strings.Split(s, ".")
-	if len(parts) > 2 {
-		return 0, "", errors.New("bad price")
+	d, err := ParseDecimal(s)
+	if err != nil {
+		return Decimal{}, errBadPrice
 	}
-	if parts[0] == "" {
-		return 0, "", errors.New("bad price")
+	d, ok := d.Round(col.Scale, rounding)
+	if !ok {
+		return Decimal{}, errTooManyDecimals
 	}
-	for _, ch := range parts[0] {
-		if ch < '0' || ch > '9' {
-			return 0, "", errors.New("bad price")
-		}
+	// 0.001 после округления тоже ноль
+	if d.Sign() <= 0 {
+		return Decimal{}, errNonPositivePrice
 	}
-	if len(parts) == 2 {
-		if len(parts[1]) == 0 {
-			return 0, "", errors.New("bad price")
-		}
-		if len(parts[1]) > 2 {
-			return 0, "", errors.New("too many fractional digits")
-		}
-		for _, ch := range parts[1] {
-			if ch < '0' || ch > '9' {
-				return 0, "", errors.New("bad price")
-			}
-		}
+	if d.IntDigits() > int(col.Precision-col.Scale) {
+		return Decimal{}, errPriceOverflow
 	}
+	return d, nil
+}
 
-	// float через strconv.ParseFloat
-	f, err := strconv.ParseFloat(s, 64)
-	if err != nil {
-		return 0, "", err
-	}
-	if f <= 0 {
-		return 0, "", errors.New("non-positive price")
-	}
+// exportHeader — колонки data.csv. В id, как и при импорте, лежит
+// external_id, чтобы выгрузку можно было загрузить обратно; prices.id — в row_id.
+var exportHeader = []string{"id", "name", "category", "price", "create_date", "currency", "source", "row_id"}
 
-	cents := int64(math.Round(f * 100))
-	if cents <= 0 {
-		return 0, "", errors.New("non-positive price")
-	}
-	whole := cents / 100
-	frac := cents % 100
-	canon := fmt.Sprintf("%d.%02d", whole, frac)
-	return cents, canon, nil
+type exportRow struct {
+	ID         int64
+	ExternalID *string
+	Name       string
+	Category   string
+	Price      string
+	CreateDate time.Time
+	Currency   string
+	Source     string
 }
 
-func parseNumericText(s string) any {
-	s = strings.TrimSpace(s)
-	if strings.HasSuffix(s, ".00") {
-		var n int64
-		_, err := fmt.Sscanf(strings.TrimSuffix(s, ".00"), "%d", &n)
-		if err == nil {
-			return n
-		}
-	}
-	var f float64
-	_, err := fmt.Sscanf(s, "%f", &f)
-	if err == nil {
-		return f
+// record — строка data.csv в порядке exportHeader.
+func (r exportRow) record() []string {
+	ext := ""
+	if r.ExternalID != nil {
+		ext = *r.ExternalID
+	}
+	return []string{
+		ext,
+		r.Name,
+		r.Category,
+		r.Price,
+		r.CreateDate.Format("2006-01-02"),
+		r.Currency,
+		r.Source,
+		fmt.Sprintf("%d", r.ID),
 	}
-	return 0
 }
 
 func (s *Service) ExportZip(ctx context.Context, f ExportFilters) ([]byte, error) {
-	q := `SELECT id, name, category, price::text, create_date FROM prices WHERE 1=1`
 	args := []any{}
 	n := 1
 
+	priceExpr, curExpr := "price", "currency"
+	if f.Currency != "" {
+		target := fmt.Sprintf("$%d::text", n)
+		priceExpr, curExpr = convertedPriceSQL(target, s.column.Scale), target
+		args = append(args, f.Currency)
+		n++
+	}
+	q := fmt.Sprintf(`SELECT id, name, category, price::text, create_date, currency, source, external_id
+FROM (SELECT id, name, category, %s AS price, create_date, %s AS currency, source, external_id FROM prices) p
+WHERE 1=1`, priceExpr, curExpr)
+
 	if f.Start != nil {
 		q += fmt.Sprintf(" AND create_date >= $%d", n)
 		args = append(args, *f.Start)
@@ -345,16 +604,27 @@ func (s *Service) ExportZip(ctx context.Context, f ExportFilters) ([]byte, error
 		args = append(args, *f.End)
 		n++
 	}
+	// строки без курса (price IS NULL) не отсеиваем, чтобы ниже вернуть ошибку
 	if f.Min != nil {
-		q += fmt.Sprintf(" AND price >= $%d::numeric", n)
+		q += fmt.Sprintf(" AND (price IS NULL OR price >= $%d::numeric)", n)
 		args = append(args, fmt.Sprintf("%d.00", *f.Min))
 		n++
 	}
 	if f.Max != nil {
-		q += fmt.Sprintf(" AND price <= $%d::numeric", n)
+		q += fmt.Sprintf(" AND (price IS NULL OR price <= $%d::numeric)", n)
 		args = append(args, fmt.Sprintf("%d.00", *f.Max))
 		n++
 	}
+	if f.Source != nil {
+		q += fmt.Sprintf(" AND source = $%d", n)
+		args = append(args, *f.Source)
+		n++
+	}
+	if len(f.ExternalIDs) > 0 {
+		q += fmt.Sprintf(" AND external_id = ANY($%d)", n)
+		args = append(args, f.ExternalIDs)
+		n++
+	}
 	q += " ORDER BY create_date, category, name"
 
 	rows, err := s.pool.Query(ctx, q, args...)
@@ -372,27 +642,23 @@ func (s *Service) ExportZip(ctx context.Context, f ExportFilters) ([]byte, error
 	}
 
 	cw := csv.NewWriter(fw)
-	if err := cw.Write([]string{"id", "name", "category", "price", "create_date"}); err != nil {
+	if err := cw.Write(exportHeader); err != nil {
 		return nil, fmt.Errorf("csv write header: %w", err)
 	}
 
 	for rows.Next() {
-		var id int64
-		var name, category string
-		var priceTxt string
-		var createDate time.Time
+		var r exportRow
+		var priceTxt *string
 
-		if err := rows.Scan(&id, &name, &category, &priceTxt, &createDate); err != nil {
+		if err := rows.Scan(&r.ID, &r.Name, &r.Category, &priceTxt, &r.CreateDate, &r.Currency, &r.Source, &r.ExternalID); err != nil {
 			return nil, fmt.Errorf("scan: %w", err)
 		}
+		if priceTxt == nil {
+			return nil, importErrorf(CodeNoRate, "no exchange rate to convert row %d into %s on %s", r.ID, f.Currency, r.CreateDate.Format("2006-01-02"))
+		}
+		r.Price = *priceTxt
 
-		if err := cw.Write([]string{
-			fmt.Sprintf("%d", id),
-			name,
-			category,
-			priceTxt,
-			createDate.Format("2006-01-02"),
-		}); err != nil {
+		if err := cw.Write(r.record()); err != nil {
 			return nil, fmt.Errorf("csv write row: %w", err)
 		}
 	}
@@ -0,0 +1,31 @@
+package prices
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// id из файла поставщика храним как external_id. Уникален он только в
+// пределах источника (source): у разных поставщиков id пересекаются.
+const maxExternalIDLen = 255
+
+var sourceRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// ParseSource проверяет имя источника; пусто — источник по умолчанию ("").
+func ParseSource(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	if !sourceRe.MatchString(s) {
+		return "", fmt.Errorf("query param 'source' must be 1-64 characters of letters, digits, '_', '.' or '-'")
+	}
+	return s, nil
+}
+
+// keyedByExternalID — upsert ищет строки по external_id, то есть внутри source.
+func keyedByExternalID(opts ImportOptions) bool {
+	return opts.Mode == ModeUpsert && slices.Contains(opts.UpsertKey, "external_id")
+}
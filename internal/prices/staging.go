@@ -0,0 +1,205 @@
+package prices
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const stagingTable = "prices_staging"
+
+var stagingColumns = []string{"seq", "name", "category", "price", "create_date", "currency", "line", "external_id"}
+
+const createStagingSQL = `
+CREATE TEMP TABLE IF NOT EXISTS prices_staging (
+  seq BIGINT NOT NULL,
+  name TEXT NOT NULL,
+  category TEXT NOT NULL,
+  price NUMERIC NOT NULL,
+  create_date DATE NOT NULL,
+  currency TEXT NOT NULL,
+  line BIGINT NOT NULL,
+  external_id TEXT NOT NULL
+) ON COMMIT DROP;
+`
+
+// Вставленные id запоминаем в prices_imported для статистики импорта.
+// $1 — id импорта, $2 — файл внутри архива, $3 — источник.
+const mergeStagingSQL = `
+WITH ins AS (
+  INSERT INTO prices(name, category, price, create_date, currency, import_id, source_entry, source_line, source, external_id)
+  SELECT name, category, price, create_date, currency, $1::bigint, NULLIF($2::text, ''), line, $3::text, NULLIF(external_id, '')
+  FROM prices_staging
+  ORDER BY seq
+  ON CONFLICT (name, category, price, create_date, currency) DO NOTHING
+  RETURNING id
+)
+INSERT INTO prices_imported(id) SELECT id FROM ins;
+`
+
+const truncateStagingSQL = `TRUNCATE prices_staging;`
+
+// Режимы обработки конфликтов при импорте.
+const (
+	ModeSkip   = "skip"
+	ModeFail   = "fail"
+	ModeUpsert = "upsert"
+)
+
+// Колонки, из которых можно собрать ключ для upsert. price в ключ не входит —
+// именно его upsert и обновляет (вместе с currency, если она не в ключе).
+// external_id сравнивается только внутри источника импорта.
+var upsertKeyColumns = map[string]bool{"name": true, "category": true, "create_date": true, "currency": true, "external_id": true}
+
+var DefaultUpsertKey = []string{"name", "category", "create_date", "currency"}
+
+func ParseImportMode(s string) (string, error) {
+	switch m := strings.ToLower(strings.TrimSpace(s)); m {
+	case "":
+		return ModeSkip, nil
+	case ModeSkip, ModeFail, ModeUpsert:
+		return m, nil
+	default:
+		return "", fmt.Errorf("query param 'mode' must be one of: skip, fail, upsert")
+	}
+}
+
+// ParseUpsertKey разбирает "name,category,create_date,currency" или, например,
+// "external_id". Пусто — ключ по умолчанию.
+func ParseUpsertKey(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultUpsertKey, nil
+	}
+	seen := map[string]bool{}
+	var key []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if !upsertKeyColumns[c] {
+			return nil, fmt.Errorf("invalid upsert key column %q (allowed: name, category, create_date, currency, external_id)", c)
+		}
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		key = append(key, c)
+	}
+	return key, nil
+}
+
+type mergeCounts struct {
+	inserted int64
+	updated  int64
+}
+
+// mergeStaging переносит строки из staging в prices согласно режиму.
+// Всё, что не вставлено и не обновлено, считается дублем.
+func mergeStaging(ctx context.Context, tx pgx.Tx, entry string, opts ImportOptions) (mergeCounts, error) {
+	var importID any
+	if opts.ImportID != 0 {
+		importID = opts.ImportID
+	}
+
+	if opts.Mode != ModeUpsert {
+		// Дубли (и с таблицей, и внутри файла) отсекает UNIQUE, порядок вставки как в файле
+		tag, err := tx.Exec(ctx, mergeStagingSQL, importID, entry, opts.Source)
+		if err != nil {
+			return mergeCounts{}, err
+		}
+		return mergeCounts{inserted: tag.RowsAffected()}, nil
+	}
+
+	key := opts.UpsertKey
+	if len(key) == 0 {
+		key = DefaultUpsertKey
+	}
+	cols := strings.Join(key, ", ")
+	// source — параметр запроса, его номер у update и insert разный
+	match := func(a, b, source string) string {
+		conds := make([]string, len(key))
+		for i, c := range key {
+			conds[i] = fmt.Sprintf("%s.%s = %s.%s", a, c, b, c)
+		}
+		if keyedByExternalID(opts) {
+			conds = append(conds, fmt.Sprintf("%s.source = %s::text", a, source))
+		}
+		return strings.Join(conds, " AND ")
+	}
+
+	// Если ключ в файле повторяется, побеждает последняя строка
+	latest := fmt.Sprintf(`latest AS (
+  SELECT DISTINCT ON (%s) seq, name, category, price, create_date, currency, line, external_id
+  FROM prices_staging
+  ORDER BY %s, seq DESC
+)`, cols, cols)
+
+	// Обновляем по одной (самой старой) строке на ключ и только если
+	// строки с такой же ценой ещё нет — иначе это дубль. Ключ может не
+	// покрывать ux_prices_dedupe (например, external_id), поэтому отдельно
+	// пропускаем обновления, после которых строка совпала бы по
+	// (name, category, price, create_date, currency) с другой — уже
+	// существующей или обновлённой этим же запросом.
+	updateSQL := fmt.Sprintf(`
+WITH %s,
+target AS (
+  SELECT DISTINCT ON (%s) p.id, p.name, p.category, p.create_date, s.price, s.currency
+  FROM prices p
+  JOIN latest s ON %s
+  WHERE NOT EXISTS (
+    SELECT 1 FROM prices p2 WHERE %s AND p2.price = s.price AND p2.currency = s.currency
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM prices p3
+    WHERE p3.name = p.name AND p3.category = p.category AND p3.create_date = p.create_date
+      AND p3.price = s.price AND p3.currency = s.currency
+  )
+  ORDER BY %s, p.id
+),
+uniq AS (
+  SELECT DISTINCT ON (name, category, create_date, price, currency) id, price, currency
+  FROM target
+  ORDER BY name, category, create_date, price, currency, id
+)
+UPDATE prices p SET price = t.price, currency = t.currency, updated_import_id = $1::bigint
+FROM uniq t
+WHERE p.id = t.id;`, latest, prefixCols("p", key), match("p", "s", "$2"), match("p2", "s", "$2"), prefixCols("p", key))
+
+	insertSQL := fmt.Sprintf(`
+WITH %s,
+ins AS (
+  INSERT INTO prices(name, category, price, create_date, currency, import_id, source_entry, source_line, source, external_id)
+  SELECT name, category, price, create_date, currency, $1::bigint, NULLIF($2::text, ''), line, $3::text, NULLIF(external_id, '')
+  FROM latest s
+  WHERE NOT EXISTS (SELECT 1 FROM prices p WHERE %s)
+  ORDER BY seq
+  ON CONFLICT (name, category, price, create_date, currency) DO NOTHING
+  RETURNING id
+)
+INSERT INTO prices_imported(id) SELECT id FROM ins;`, latest, match("p", "s", "$3"))
+
+	updateArgs := []any{importID}
+	if keyedByExternalID(opts) {
+		updateArgs = append(updateArgs, opts.Source)
+	}
+	tag, err := tx.Exec(ctx, updateSQL, updateArgs...)
+	if err != nil {
+		return mergeCounts{}, fmt.Errorf("upsert update: %w", err)
+	}
+	mc := mergeCounts{updated: tag.RowsAffected()}
+
+	tag, err = tx.Exec(ctx, insertSQL, importID, entry, opts.Source)
+	if err != nil {
+		return mergeCounts{}, fmt.Errorf("upsert insert: %w", err)
+	}
+	mc.inserted = tag.RowsAffected()
+	return mc, nil
+}
+
+func prefixCols(alias string, cols []string) string {
+	out := make([]string, len(cols))
+	for i, c := range cols {
+		out[i] = alias + "." + c
+	}
+	return strings.Join(out, ", ")
+}
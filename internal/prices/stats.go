@@ -0,0 +1,123 @@
+package prices
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ImportStats — сводка по набору строк prices.
+type ImportStats struct {
+	Count      int64   `json:"count"`
+	Categories int64   `json:"categories"`
+	TotalPrice Decimal `json:"total_price"`
+	// nil, если строк нет
+	MinPrice *Decimal `json:"min_price"`
+	MaxPrice *Decimal `json:"max_price"`
+	MinDate  *string  `json:"min_date"`
+	MaxDate  *string  `json:"max_date"`
+
+	// валюта сумм, если запрошен пересчёт; строки без курса на свою дату
+	// в суммы и min/max не входят
+	Currency         string `json:"currency,omitempty"`
+	UnconvertedCount int64  `json:"unconverted_count,omitempty"`
+}
+
+// Id строк, вставленных текущим импортом; живёт до конца транзакции.
+const createImportedSQL = `
+CREATE TEMP TABLE IF NOT EXISTS prices_imported (
+  id BIGINT PRIMARY KEY
+) ON COMMIT DROP;
+`
+
+// fillStats считает статистику импорта и снимок всей таблицы внутри
+// транзакции импорта. Каждая сводка — один запрос, то есть один снимок
+// данных даже при READ COMMITTED.
+func fillStats(ctx context.Context, tx pgx.Tx, currency string, column PriceColumn, res *ImportResult) error {
+	var err error
+	res.Stats, err = queryStats(ctx, tx, `id IN (SELECT id FROM prices_imported)`, currency, column)
+	if err != nil {
+		return fmt.Errorf("import stats: %w", err)
+	}
+	res.Table, err = queryStats(ctx, tx, `true`, currency, column)
+	if err != nil {
+		return fmt.Errorf("table stats: %w", err)
+	}
+
+	// старые поля верхнего уровня — про всю таблицу
+	res.TotalCategories = res.Table.Categories
+	res.TotalPrice = res.Table.TotalPrice
+	res.TotalsCurrency = res.Table.Currency
+	res.UnconvertedCount = res.Table.UnconvertedCount
+	return nil
+}
+
+func queryStats(ctx context.Context, tx pgx.Tx, where, currency string, column PriceColumn) (ImportStats, error) {
+	priceExpr := "price"
+	var args []any
+	if currency != "" {
+		priceExpr = convertedPriceSQL("$1::text", column.Scale)
+		args = append(args, currency)
+	}
+	q := fmt.Sprintf(`
+SELECT COUNT(*), COUNT(DISTINCT category),
+  COALESCE(SUM(conv), 0)::text, MIN(conv)::text, MAX(conv)::text,
+  MIN(create_date), MAX(create_date),
+  COUNT(*) FILTER (WHERE conv IS NULL)
+FROM (SELECT category, create_date, %s AS conv FROM prices WHERE %s) t`, priceExpr, where)
+
+	var st ImportStats
+	var sumTxt string
+	var minTxt, maxTxt *string
+	var minDate, maxDate *time.Time
+	var unconverted int64
+	if err := tx.QueryRow(ctx, q, args...).Scan(&st.Count, &st.Categories, &sumTxt, &minTxt, &maxTxt, &minDate, &maxDate, &unconverted); err != nil {
+		return ImportStats{}, err
+	}
+
+	// SUM по пустому набору — "0", приводим всё к масштабу колонки
+	var err error
+	if st.TotalPrice, err = statsDecimal(sumTxt, column); err != nil {
+		return ImportStats{}, err
+	}
+	for _, p := range []struct {
+		txt *string
+		dst **Decimal
+	}{{minTxt, &st.MinPrice}, {maxTxt, &st.MaxPrice}} {
+		if p.txt == nil {
+			continue
+		}
+		d, err := statsDecimal(*p.txt, column)
+		if err != nil {
+			return ImportStats{}, err
+		}
+		*p.dst = &d
+	}
+	st.MinDate = formatDatePtr(minDate)
+	st.MaxDate = formatDatePtr(maxDate)
+	if currency != "" {
+		st.Currency = currency
+		st.UnconvertedCount = unconverted
+	}
+	return st, nil
+}
+
+func statsDecimal(s string, column PriceColumn) (Decimal, error) {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		return Decimal{}, fmt.Errorf("parse numeric %q: %w", s, err)
+	}
+	// цены и пересчёт уже в масштабе колонки, так что округление не срабатывает
+	d, _ = d.Round(column.Scale, RoundHalfEven)
+	return d, nil
+}
+
+func formatDatePtr(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(DefaultDateLayout)
+	return &s
+}
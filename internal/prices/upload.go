@@ -1,6 +1,8 @@
 package prices
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +14,21 @@ import (
 	"strings"
 )
 
+// FileSHA256 — hex sha256 содержимого файла.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash %s: %w", filepath.Base(path), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 func ExtractUploadToTempFile(r *http.Request, maxUploadMB int64) (string, func(), error) {
 	maxBytes := maxUploadMB * 1024 * 1024
 
@@ -0,0 +1,407 @@
+package prices
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Минимальный читатель xlsx: workbook.xml -> rels -> лист, sharedStrings.
+// Стили не разбираем — числовые даты узнаём по колонке create_date.
+
+func isXLSX(zr *zip.Reader) bool {
+	for _, f := range zr.File {
+		if f.Name == "xl/workbook.xml" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) importXLSX(ctx context.Context, tx pgx.Tx, tempFilePath string, guard *archiveGuard, opts ImportOptions, res *ImportResult) error {
+	if len(opts.Entries) > 0 {
+		return importErrorf(CodeEntryNotFound, "xlsx: use 'sheet' instead of 'entry'")
+	}
+
+	zr, err := zip.OpenReader(tempFilePath)
+	if err != nil {
+		return fmt.Errorf("open xlsx: %w", err)
+	}
+	defer zr.Close()
+
+	// xlsx — тот же zip, и бомбой может быть любой его xml
+	if err := guard.zipEntries(&zr.Reader); err != nil {
+		return err
+	}
+
+	wb, err := readWorkbook(&zr.Reader, guard)
+	if err != nil {
+		return err
+	}
+
+	sheet, err := wb.pick(opts.Sheet)
+	if err != nil {
+		return err
+	}
+
+	shared, err := readSharedStrings(&zr.Reader, guard)
+	if err != nil {
+		return err
+	}
+
+	sf := findZipFile(&zr.Reader, sheet.path)
+	if sf == nil {
+		return importErrorf(CodeBadXLSX, "xlsx: sheet %q not found in archive", sheet.name)
+	}
+	rc, err := sf.Open()
+	if err != nil {
+		return fmt.Errorf("xlsx open sheet: %w", err)
+	}
+	defer rc.Close()
+
+	sr := &sheetReader{dec: xml.NewDecoder(guard.reader(rc)), shared: shared, date1904: wb.date1904, dateCol: -1, priceCol: -1, price: opts.Price}
+
+	var colIndex map[string]int
+	if opts.columns.headerless() {
+		colIndex = opts.columns.positionIndex()
+		if opts.columns.SkipHeader {
+			if _, _, err := sr.next(); err != nil && err != io.EOF {
+				return err
+			}
+		}
+	} else {
+		header, _, err := sr.next()
+		if err == io.EOF {
+			return importErrorf(CodeBadXLSX, "xlsx: sheet %q is empty", sheet.name)
+		}
+		if err != nil {
+			return err
+		}
+		colIndex, err = headerIndex(header, sheet.name, opts.columns)
+		if err != nil {
+			return err
+		}
+	}
+	sr.dateCol = colIndex["create_date"]
+	sr.priceCol = colIndex["price"]
+	opts.isoDate = func() bool { return sr.dateISO }
+
+	return s.importRows(ctx, tx, sheet.name, colIndex, sr.next, opts, res)
+}
+
+type xlsxSheet struct {
+	name string
+	path string
+}
+
+type xlsxWorkbook struct {
+	sheets   []xlsxSheet
+	date1904 bool
+}
+
+func (wb xlsxWorkbook) pick(name string) (xlsxSheet, error) {
+	if len(wb.sheets) == 0 {
+		return xlsxSheet{}, importErrorf(CodeBadXLSX, "xlsx: workbook has no sheets")
+	}
+	if name == "" {
+		return wb.sheets[0], nil
+	}
+	for _, sh := range wb.sheets {
+		if sh.name == name {
+			return sh, nil
+		}
+	}
+	return xlsxSheet{}, importErrorf(CodeEntryNotFound, "xlsx: sheet %q not found", name)
+}
+
+func readWorkbook(zr *zip.Reader, guard *archiveGuard) (xlsxWorkbook, error) {
+	var wbXML struct {
+		WorkbookPr struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeZipXML(zr, "xl/workbook.xml", guard, &wbXML); err != nil {
+		return xlsxWorkbook{}, err
+	}
+
+	var relsXML struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeZipXML(zr, "xl/_rels/workbook.xml.rels", guard, &relsXML); err != nil {
+		return xlsxWorkbook{}, err
+	}
+	targets := map[string]string{}
+	for _, r := range relsXML.Rels {
+		t := r.Target
+		if strings.HasPrefix(t, "/") {
+			t = strings.TrimPrefix(t, "/")
+		} else {
+			t = path.Join("xl", t)
+		}
+		targets[r.ID] = t
+	}
+
+	wb := xlsxWorkbook{date1904: wbXML.WorkbookPr.Date1904 == "1" || wbXML.WorkbookPr.Date1904 == "true"}
+	for i, sh := range wbXML.Sheets {
+		p, ok := targets[sh.RID]
+		if !ok {
+			// strict-вариант OOXML с другим namespace у r:id
+			p = fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)
+		}
+		wb.sheets = append(wb.sheets, xlsxSheet{name: sh.Name, path: p})
+	}
+	return wb, nil
+}
+
+func readSharedStrings(zr *zip.Reader, guard *archiveGuard) ([]string, error) {
+	if findZipFile(zr, "xl/sharedStrings.xml") == nil {
+		return nil, nil
+	}
+	var sst struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if err := decodeZipXML(zr, "xl/sharedStrings.xml", guard, &sst); err != nil {
+		return nil, err
+	}
+	out := make([]string, len(sst.Items))
+	for i, it := range sst.Items {
+		out[i] = it.String()
+	}
+	return out, nil
+}
+
+// xlsxText — <si>/<is>: либо простой <t>, либо rich text из нескольких <r><t>.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var sb strings.Builder
+	for _, r := range t.Runs {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+func findZipFile(zr *zip.Reader, name string) *zip.File {
+	for _, f := range zr.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func decodeZipXML(zr *zip.Reader, name string, guard *archiveGuard, v any) error {
+	f := findZipFile(zr, name)
+	if f == nil {
+		return importErrorf(CodeBadXLSX, "xlsx: %s not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("xlsx open %s: %w", name, err)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(guard.reader(rc)).Decode(v); err != nil {
+		var ie *ImportError
+		if errors.As(err, &ie) {
+			return err
+		}
+		return importErrorf(CodeBadXLSX, "xlsx: parse %s: %v", name, err)
+	}
+	return nil
+}
+
+// sheetReader читает лист потоком, по одной строке <row> за раз.
+type sheetReader struct {
+	dec      *xml.Decoder
+	shared   []string
+	date1904 bool
+	dateCol  int
+	priceCol int
+	// дата последней строки взята из числовой или ISO-ячейки, уже разобрана
+	dateISO bool
+	price   PriceDialect
+	lastRow int64
+}
+
+type xlsxCell struct {
+	Ref  string   `xml:"r,attr"`
+	Type string   `xml:"t,attr"`
+	V    string   `xml:"v"`
+	Is   xlsxText `xml:"is"`
+}
+
+func (sr *sheetReader) next() ([]string, int64, error) {
+	for {
+		tok, err := sr.dec.Token()
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		var ie *ImportError
+		if errors.As(err, &ie) {
+			return nil, 0, err
+		}
+		if err != nil {
+			return nil, 0, importErrorf(CodeBadXLSX, "xlsx: read sheet: %v", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "row" {
+			continue
+		}
+
+		var row struct {
+			R     string     `xml:"r,attr"`
+			Cells []xlsxCell `xml:"c"`
+		}
+		if err := sr.dec.DecodeElement(&row, &se); err != nil {
+			var ie *ImportError
+			if errors.As(err, &ie) {
+				return nil, 0, err
+			}
+			return nil, 0, importErrorf(CodeBadXLSX, "xlsx: read row: %v", err)
+		}
+
+		line := sr.lastRow + 1
+		if n, err := strconv.ParseInt(row.R, 10, 64); err == nil {
+			line = n
+		}
+		sr.lastRow = line
+
+		var rec []string
+		empty := true
+		sr.dateISO = false
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				if n, ok := cellColumn(c.Ref); ok {
+					col = n
+				}
+			}
+			// иначе ссылка вроде ZZZZZZZ1 раздует rec до миллиардов колонок
+			if col >= xlsxMaxColumns {
+				return nil, 0, importErrorf(CodeBadXLSX, "xlsx: cell %q is beyond the last column XFD", c.Ref)
+			}
+			for len(rec) <= col {
+				rec = append(rec, "")
+			}
+			rec[col] = sr.cellValue(c, col)
+			if strings.TrimSpace(rec[col]) != "" {
+				empty = false
+			}
+		}
+		// пустые, но отформатированные строки Excel любит оставлять в конце листа
+		if empty {
+			continue
+		}
+		return rec, line, nil
+	}
+}
+
+func (sr *sheetReader) cellValue(c xlsxCell, col int) string {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.V)
+		if err != nil || i < 0 || i >= len(sr.shared) {
+			return ""
+		}
+		return sr.shared[i]
+	case "inlineStr":
+		return c.Is.String()
+	case "str", "e":
+		return c.V
+	case "b":
+		if c.V == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "d":
+		// ISO-дата, оставляем только дату
+		if t, err := time.Parse("2006-01-02T15:04:05", c.V); err == nil {
+			if col == sr.dateCol {
+				sr.dateISO = true
+			}
+			return t.Format("2006-01-02")
+		}
+		return c.V
+	default:
+		f, err := strconv.ParseFloat(c.V, 64)
+		if err != nil {
+			return c.V
+		}
+		if col == sr.dateCol {
+			sr.dateISO = true
+			return excelSerialToDate(f, sr.date1904).Format("2006-01-02")
+		}
+		if col == sr.priceCol {
+			return sr.price.localize(excelNumber(f))
+		}
+		return excelNumber(f)
+	}
+}
+
+// excelNumber убирает хвосты двоичного представления (799.99000000000001),
+// оставляя 15 значащих цифр, как показывает сам Excel.
+func excelNumber(f float64) string {
+	g, err := strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+	if err != nil {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(g, 'f', -1, 64)
+}
+
+func excelSerialToDate(serial float64, date1904 bool) time.Time {
+	// 1899-12-30 вместо 1900-01-01 компенсирует несуществующее 29.02.1900
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		base = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return base.AddDate(0, 0, int(math.Floor(serial)))
+}
+
+// Колонок на листе Excel не больше 16384 (A..XFD).
+const xlsxMaxColumns = 16384
+
+// cellColumn: "B12" -> 1. Для ссылок дальше XFD возвращает индекс
+// >= xlsxMaxColumns, не досчитывая до переполнения.
+func cellColumn(ref string) (int, bool) {
+	n := 0
+	i := 0
+	for ; i < len(ref); i++ {
+		ch := ref[i]
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		n = n*26 + int(ch-'A'+1)
+		if n > xlsxMaxColumns {
+			return n - 1, true
+		}
+	}
+	if i == 0 {
+		return 0, false
+	}
+	return n - 1, true
+}
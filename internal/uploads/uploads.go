@@ -0,0 +1,403 @@
+package uploads
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound       = errors.New("upload session not found")
+	ErrOffsetMismatch = errors.New("offset does not match current upload size")
+	ErrTooLarge       = errors.New("upload exceeds size limit")
+	ErrIncomplete     = errors.New("upload is incomplete")
+	ErrFinalizing     = errors.New("upload is being imported")
+)
+
+// Session — состояние докачиваемой загрузки. Offset — сколько байт уже принято,
+// он всегда равен размеру файла на диске.
+type Session struct {
+	ID        string    `json:"id"`
+	Offset    int64     `json:"offset"`
+	Size      int64     `json:"size,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// идёт импорт; чанки не принимаются, пока не вызван Release
+	Finalizing bool `json:"finalizing,omitempty"`
+}
+
+// Store хранит сессии в каталоге: <id>.part с данными и <id>.json с метаданными,
+// так что незавершённые загрузки переживают рестарт. <id>.upload — файл,
+// отданный на импорт.
+type Store struct {
+	dir      string
+	ttl      time.Duration
+	maxBytes int64
+	logger   *slog.Logger
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func NewStore(dir string, ttl time.Duration, maxBytes int64, logger *slog.Logger) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("upload dir: %w", err)
+	}
+	s := &Store{
+		dir:      dir,
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		logger:   logger,
+		locks:    map[string]*sync.Mutex{},
+	}
+	s.resetFinalizing()
+	return s, nil
+}
+
+// resetFinalizing снимает флаг с сессий, импорт которых прервал рестарт:
+// при старте ни один импорт ещё не идёт.
+func (s *Store) resetFinalizing() {
+	metas, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, m := range metas {
+		sess, err := s.readMeta(strings.TrimSuffix(filepath.Base(m), ".json"))
+		if err != nil || !sess.Finalizing {
+			continue
+		}
+		sess.Finalizing = false
+		if err := s.writeMeta(sess); err != nil {
+			s.logger.Warn("reset upload session failed", "id", sess.ID, "err", err)
+		}
+	}
+}
+
+// Create открывает сессию. size — ожидаемый полный размер, 0 если неизвестен.
+func (s *Store) Create(size int64) (Session, error) {
+	if size < 0 {
+		return Session{}, errors.New("size must be >= 0")
+	}
+	if size > s.maxBytes {
+		return Session{}, ErrTooLarge
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return Session{}, fmt.Errorf("session id: %w", err)
+	}
+	now := time.Now().UTC()
+	sess := Session{
+		ID:        hex.EncodeToString(b),
+		Size:      size,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}
+
+	f, err := os.OpenFile(s.dataPath(sess.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return Session{}, fmt.Errorf("create upload file: %w", err)
+	}
+	_ = f.Close()
+
+	if err := s.writeMeta(sess); err != nil {
+		_ = os.Remove(s.dataPath(sess.ID))
+		return Session{}, err
+	}
+	return sess, nil
+}
+
+func (s *Store) Get(id string) (Session, error) {
+	unlock := s.lock(id)
+	defer unlock()
+	return s.load(id)
+}
+
+// Append дописывает чанк, если offset совпадает с уже принятым размером.
+// Оборванный на середине чанк остаётся записанным — клиент узнает новый
+// offset через Get и продолжит с него.
+func (s *Store) Append(id string, offset int64, r io.Reader) (Session, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	sess, err := s.load(id)
+	if err != nil {
+		return Session{}, err
+	}
+	if sess.Finalizing {
+		return sess, ErrFinalizing
+	}
+	if offset != sess.Offset {
+		return sess, ErrOffsetMismatch
+	}
+
+	limit := s.maxBytes
+	if sess.Size > 0 {
+		limit = sess.Size
+	}
+
+	f, err := os.OpenFile(s.dataPath(id), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return Session{}, fmt.Errorf("open upload file: %w", err)
+	}
+	n, copyErr := io.Copy(f, io.LimitReader(r, limit-offset+1))
+	if offset+n > limit {
+		// откатываем чанк целиком, чтобы не оставлять лишние байты
+		_ = f.Truncate(offset)
+		_ = f.Close()
+		return sess, ErrTooLarge
+	}
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	sess.Offset = offset + n
+	sess.ExpiresAt = time.Now().UTC().Add(s.ttl)
+	if err := s.writeMeta(sess); err != nil {
+		return Session{}, err
+	}
+	if copyErr != nil {
+		return sess, fmt.Errorf("write chunk: %w", copyErr)
+	}
+	return sess, nil
+}
+
+// Finalize отдаёт собранный файл на импорт: жёсткую ссылку <id>.upload,
+// которая переходит вызывающему вместе с cleanup. Сама сессия остаётся
+// (без приёма чанков) до Release: если импорт не удался, загрузку не
+// придётся передавать заново.
+func (s *Store) Finalize(id string) (string, func(), error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	sess, err := s.load(id)
+	if err != nil {
+		return "", nil, err
+	}
+	if sess.Finalizing {
+		return "", nil, ErrFinalizing
+	}
+	if sess.Offset == 0 || (sess.Size > 0 && sess.Offset != sess.Size) {
+		return "", nil, ErrIncomplete
+	}
+
+	final := s.uploadPath(id)
+	_ = os.Remove(final)
+	if err := os.Link(s.dataPath(id), final); err != nil {
+		return "", nil, fmt.Errorf("finalize upload: %w", err)
+	}
+	// sweep смотрит на mtime .upload, отсчитываем его от финализации
+	now := time.Now()
+	_ = os.Chtimes(final, now, now)
+
+	sess.Finalizing = true
+	if err := s.writeMeta(sess); err != nil {
+		_ = os.Remove(final)
+		return "", nil, err
+	}
+	return final, func() { _ = os.Remove(final) }, nil
+}
+
+// Release завершает Finalize: imported — файл импортирован или поставлен
+// в очередь, сессия больше не нужна; иначе она снова принимает запросы.
+func (s *Store) Release(id string, imported bool) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	if imported {
+		s.remove(id)
+		return
+	}
+	sess, err := s.readMeta(id)
+	if err != nil {
+		return
+	}
+	sess.Finalizing = false
+	if err := s.writeMeta(sess); err != nil {
+		s.logger.Warn("release upload session failed", "id", id, "err", err)
+	}
+}
+
+func (s *Store) Delete(id string) error {
+	unlock := s.lock(id)
+	defer unlock()
+
+	if _, err := s.load(id); err != nil {
+		return err
+	}
+	s.remove(id)
+	return nil
+}
+
+// RunJanitor периодически удаляет просроченные сессии до отмены ctx.
+// inUse сообщает, что .upload ещё ждёт фоновый импорт; такой файл не трогаем.
+func (s *Store) RunJanitor(ctx context.Context, interval time.Duration, inUse func(ctx context.Context, path string) (bool, error)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		s.sweep(ctx, inUse)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Store) sweep(ctx context.Context, inUse func(ctx context.Context, path string) (bool, error)) {
+	metas, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, m := range metas {
+		id := strings.TrimSuffix(filepath.Base(m), ".json")
+		unlock := s.lock(id)
+		sess, err := s.readMeta(id)
+		if err != nil || (now.After(sess.ExpiresAt) && !sess.Finalizing) {
+			s.remove(id)
+			s.logger.Info("upload session expired", "id", id)
+		}
+		unlock()
+	}
+
+	// .part без метаданных (упали между созданием файла и записью .json) и
+	// .upload, брошенные упавшим синхронным импортом. .upload async-задачи
+	// удаляет воркер, пока задача в очереди — файл её.
+	for _, pattern := range []string{"*.part", "*.upload"} {
+		files, err := filepath.Glob(filepath.Join(s.dir, pattern))
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			id := strings.TrimSuffix(filepath.Base(f), filepath.Ext(f))
+			unlock := s.lock(id)
+			st, err := os.Stat(f)
+			_, metaErr := os.Stat(s.metaPath(id))
+			orphan := pattern == "*.upload" || errors.Is(metaErr, os.ErrNotExist)
+			if err == nil && orphan && now.Sub(st.ModTime()) > s.ttl && !s.uploadInUse(ctx, inUse, f) {
+				_ = os.Remove(f)
+				s.logger.Info("orphaned upload file removed", "file", filepath.Base(f))
+			}
+			if metaErr != nil {
+				s.forget(id)
+			}
+			unlock()
+		}
+	}
+}
+
+// uploadInUse — .upload ещё нужен задаче импорта. Если проверить не
+// удалось, файл оставляем до следующего прохода.
+func (s *Store) uploadInUse(ctx context.Context, inUse func(ctx context.Context, path string) (bool, error), path string) bool {
+	if filepath.Ext(path) != ".upload" || inUse == nil {
+		return false
+	}
+	used, err := inUse(ctx, path)
+	if err != nil {
+		s.logger.Warn("check upload in use failed", "file", filepath.Base(path), "err", err)
+		return true
+	}
+	return used
+}
+
+func (s *Store) load(id string) (Session, error) {
+	if !validID(id) {
+		return Session{}, ErrNotFound
+	}
+	sess, err := s.readMeta(id)
+	if errors.Is(err, os.ErrNotExist) {
+		return Session{}, ErrNotFound
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	if time.Now().After(sess.ExpiresAt) {
+		s.remove(id)
+		return Session{}, ErrNotFound
+	}
+
+	// принятый размер берём с диска: метаданные могли не успеть записаться
+	st, err := os.Stat(s.dataPath(id))
+	if err != nil {
+		s.remove(id)
+		return Session{}, ErrNotFound
+	}
+	sess.Offset = st.Size()
+	return sess, nil
+}
+
+func (s *Store) readMeta(id string) (Session, error) {
+	b, err := os.ReadFile(s.metaPath(id))
+	if err != nil {
+		return Session{}, err
+	}
+	var sess Session
+	if err := json.Unmarshal(b, &sess); err != nil {
+		return Session{}, fmt.Errorf("decode upload session: %w", err)
+	}
+	return sess, nil
+}
+
+func (s *Store) writeMeta(sess Session) error {
+	b, err := json.Marshal(sess)
+	if err != nil {
+		return fmt.Errorf("encode upload session: %w", err)
+	}
+	tmp := s.metaPath(sess.ID) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("write upload session: %w", err)
+	}
+	if err := os.Rename(tmp, s.metaPath(sess.ID)); err != nil {
+		return fmt.Errorf("write upload session: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) remove(id string) {
+	_ = os.Remove(s.dataPath(id))
+	_ = os.Remove(s.metaPath(id))
+	s.forget(id)
+}
+
+func (s *Store) lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[id] = l
+	}
+	s.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+func (s *Store) forget(id string) {
+	s.mu.Lock()
+	delete(s.locks, id)
+	s.mu.Unlock()
+}
+
+func (s *Store) dataPath(id string) string   { return filepath.Join(s.dir, id+".part") }
+func (s *Store) metaPath(id string) string   { return filepath.Join(s.dir, id+".json") }
+func (s *Store) uploadPath(id string) string { return filepath.Join(s.dir, id+".upload") }
+
+// validID не даёт подсунуть путь вместо идентификатора.
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}